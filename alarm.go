@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+)
+
+// alarmStates returns the current state of each of the named CloudWatch
+// alarms.
+func alarmStates(ctx context.Context, names []string) (map[string]string, error) {
+	req := &cloudwatch.DescribeAlarmsInput{AlarmNames: aws.StringSlice(names)}
+	res, err := cw.DescribeAlarmsWithContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]string, len(res.MetricAlarms))
+	for _, a := range res.MetricAlarms {
+		states[aws.StringValue(a.AlarmName)] = aws.StringValue(a.StateValue)
+	}
+	for _, name := range names {
+		if _, ok := states[name]; !ok {
+			return nil, fmt.Errorf("no such alarm: %s", name)
+		}
+	}
+	return states, nil
+}
+
+// waitForAlarmsOK blocks until every one of the named alarms is in the OK
+// state.
+func waitForAlarmsOK(ctx context.Context, logger *log.Logger, names []string, interval time.Duration) error {
+	for {
+		states, err := alarmStates(ctx, names)
+		if err != nil {
+			return err
+		}
+		ok := true
+		for _, name := range names {
+			if state := states[name]; state != cloudwatch.StateValueOk {
+				logger.Printf("waiting: alarm %s is %s", name, state)
+				ok = false
+			}
+		}
+		if ok {
+			logger.Printf("alarms OK: %v", names)
+			return nil
+		}
+
+		select {
+		case <-time.After(delay(interval)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
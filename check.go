@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+// statusCodes maps each known status to the exit code reported for it by
+// --check --status-code-only. The codes are part of the tool's interface:
+// new statuses get new codes, and existing codes never change.
+var statusCodes = []struct {
+	status string
+	code   int
+}{
+	{"available", 0},
+
+	{"backing-up", 10},
+	{"configuring-enhanced-monitoring", 11},
+	{"configuring-iam-database-auth", 12},
+	{"configuring-log-exports", 13},
+	{"converting-to-vpc", 14},
+	{"creating", 15},
+	{"delete-precheck", 16},
+	{"deleting", 17},
+	{"maintenance", 18},
+	{"modifying", 19},
+	{"moving-to-vpc", 20},
+	{"rebooting", 21},
+	{"renaming", 22},
+	{"resetting-master-credentials", 23},
+	{"starting", 24},
+	{"stopped", 25},
+	{"stopping", 26},
+	{"storage-config-upgrade", 27},
+	{"storage-optimization", 28},
+	{"upgrading", 29},
+
+	{"failed", 40},
+	{"inaccessible-encryption-credentials", 41},
+	{"incompatible-network", 42},
+	{"incompatible-option-group", 43},
+	{"incompatible-parameters", 44},
+	{"incompatible-restore", 45},
+	{"insufficient-capacity", 46},
+	{"restore-error", 47},
+	{"storage-full", 48},
+}
+
+// Exit codes for outcomes other than a known status.
+const (
+	codeUnknownStatus = 97
+	codeNotFound      = 98
+	codeError         = 99
+)
+
+func statusCode(status string) int {
+	for _, c := range statusCodes {
+		if c.status == status {
+			return c.code
+		}
+	}
+	return codeUnknownStatus
+}
+
+// printStatusCodes writes the exit codes used by --status-code-only to w.
+func printStatusCodes(w io.Writer) {
+	for _, c := range statusCodes {
+		fmt.Fprintf(w, "%3d  %s\n", c.code, c.status)
+	}
+	fmt.Fprintf(w, "%3d  (any other status)\n", codeUnknownStatus)
+	fmt.Fprintf(w, "%3d  (no such instance)\n", codeNotFound)
+	fmt.Fprintf(w, "%3d  (any other error)\n", codeError)
+}
+
+// check polls the instance once, without waiting, and returns the exit code
+// for the result. Normally the status is printed to out and the code is 0 if
+// it is a target status and 1 otherwise. With codeOnly, nothing is printed
+// and the code encodes the status as listed by printStatusCodes. A non-zero
+// pollTimeout bounds the describe.
+func check(ctx context.Context, out io.Writer, instanceID string, statuses statusClassifier, pollTimeout time.Duration, codeOnly bool) int {
+	if pollTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, pollTimeout)
+		defer cancel()
+	}
+	db, err := describeDBInstance(ctx, svc, instanceID)
+	if codeOnly {
+		switch {
+		case isNotFound(err):
+			return codeNotFound
+		case err != nil:
+			return codeError
+		}
+		return statusCode(*db.DBInstanceStatus)
+	}
+
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	status := *db.DBInstanceStatus
+	fmt.Fprintln(out, status)
+	if reached, _ := statuses.classify(status); !reached {
+		return 1
+	}
+	return 0
+}
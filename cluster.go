@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+func describeDBCluster(ctx context.Context, clusterID string) (*rds.DBCluster, error) {
+	req := &rds.DescribeDBClustersInput{
+		DBClusterIdentifier: aws.String(clusterID),
+		MaxRecords:          aws.Int64(20),
+	}
+	res, err := svc.DescribeDBClustersWithContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res.DBClusters) == 0 {
+		return nil, fmt.Errorf("no such cluster: %s", clusterID)
+	}
+	if len(res.DBClusters) > 1 {
+		return nil, errors.New("DescribeDBClusters query matched multiple clusters")
+	}
+	return res.DBClusters[0], nil
+}
+
+// waitCluster blocks until the cluster named by w.instanceID reaches a target
+// status. Its statuses are classified, timed and reported as an instance's
+// would be; instance conditions and follow-up checks do not apply.
+func (w *waiter) waitCluster(ctx context.Context) error {
+	for {
+		var cluster *rds.DBCluster
+		completed, err := w.withPollTimeout(ctx, func(ctx context.Context) (err error) {
+			w.polls.record(time.Now())
+			cluster, err = describeDBCluster(ctx, w.instanceID)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if completed {
+			atomic.AddInt32(&w.describes, 1)
+			status := aws.StringValue(cluster.Status)
+			w.observe(status)
+			w.logger.Printf("cluster status: %s", status)
+			events.emit(event{Event: "status", Instance: w.label(), Status: status})
+			reached, err := w.statuses.classify(status)
+			if err != nil {
+				return fmt.Errorf("cluster %s: %w", w.instanceID, err)
+			}
+			if reached {
+				return nil
+			}
+			if err := w.checkStatusTimeout(reached); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-time.After(delay(w.pollIntervals.interval(w.status))):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// clusterMembers returns the member instances of the cluster.
+func clusterMembers(ctx context.Context, clusterID string) ([]*rds.DBClusterMember, error) {
+	cluster, err := describeDBCluster(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	var members []*rds.DBClusterMember
+	for _, m := range cluster.DBClusterMembers {
+		if m.DBInstanceIdentifier != nil {
+			members = append(members, m)
+		}
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("no member instances in cluster: %s", clusterID)
+	}
+	return members, nil
+}
+
+func memberIDs(members []*rds.DBClusterMember) []string {
+	ids := make([]string, len(members))
+	for i, m := range members {
+		ids[i] = *m.DBInstanceIdentifier
+	}
+	return ids
+}
+
+// waitForClusterEndpoints blocks until the chosen endpoints of the cluster
+// (writer, reader or both) resolve and accept TCP connections.
+func waitForClusterEndpoints(ctx context.Context, logger *log.Logger, cluster *rds.DBCluster, which string) error {
+	endpoints := map[string]*string{
+		"writer": cluster.Endpoint,
+		"reader": cluster.ReaderEndpoint,
+	}
+	for _, role := range []string{"writer", "reader"} {
+		if which != role && which != "both" {
+			continue
+		}
+		host := endpoints[role]
+		if host == nil || cluster.Port == nil {
+			return fmt.Errorf("no %s endpoint for cluster: %s", role, aws.StringValue(cluster.DBClusterIdentifier))
+		}
+		if err := waitForHost(ctx, logger, *host); err != nil {
+			return err
+		}
+		if err := waitForPort(ctx, logger, *host, *cluster.Port); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// A condition inspects an instance and describes what, if anything, is still
+// outstanding. An empty description means the condition is satisfied.
+type condition func(db *rds.DBInstance) string
+
+func minUptimeCondition(minUptime time.Duration) condition {
+	return func(db *rds.DBInstance) string {
+		if db.InstanceCreateTime == nil {
+			return "no creation time reported for instance"
+		}
+		uptime := time.Since(*db.InstanceCreateTime)
+		if uptime < minUptime {
+			return fmt.Sprintf("instance created %s ago; min-uptime is %s", uptime.Round(time.Second), minUptime)
+		}
+		return ""
+	}
+}
+
+func iamAuthCondition(db *rds.DBInstance) string {
+	if enabled := aws.BoolValue(db.IAMDatabaseAuthenticationEnabled); !enabled {
+		return fmt.Sprintf("IAM database authentication enabled: %t", enabled)
+	}
+	return ""
+}
+
+func instanceClassCondition(class string) condition {
+	return func(db *rds.DBInstance) string {
+		if current := aws.StringValue(db.DBInstanceClass); current != class {
+			return fmt.Sprintf("instance class: %s (expecting %s)", current, class)
+		}
+		return ""
+	}
+}
+
+func performanceInsightsCondition(db *rds.DBInstance) string {
+	if enabled := aws.BoolValue(db.PerformanceInsightsEnabled); !enabled {
+		return fmt.Sprintf("Performance Insights enabled: %t", enabled)
+	}
+	return ""
+}
+
+func deletionProtectionCondition(want bool) condition {
+	return func(db *rds.DBInstance) string {
+		if enabled := aws.BoolValue(db.DeletionProtection); enabled != want {
+			return fmt.Sprintf("deletion protection enabled: %t (expecting %t)", enabled, want)
+		}
+		return ""
+	}
+}
+
+func promotionCondition(db *rds.DBInstance) string {
+	if source := aws.StringValue(db.ReadReplicaSourceDBInstanceIdentifier); source != "" {
+		return fmt.Sprintf("still a read replica of %s", source)
+	}
+	return ""
+}
+
+// patchCondition waits out modifications that RDS has yet to apply, and
+// parameter changes that await a reboot, either of which would interrupt
+// the instance later.
+func patchCondition(db *rds.DBInstance) string {
+	var pending []string
+	if db.PendingModifiedValues != nil {
+		v := reflect.ValueOf(db.PendingModifiedValues).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			f, name := v.Field(i), v.Type().Field(i).Name
+			if v.Type().Field(i).PkgPath != "" || f.IsNil() || f.Kind() == reflect.Slice && f.Len() == 0 {
+				continue
+			}
+			value := strings.Join(strings.Fields(awsutil.Prettify(f.Interface())), " ")
+			if name == "MasterUserPassword" {
+				value = "(redacted)"
+			}
+			pending = append(pending, name+"="+value)
+		}
+	}
+	for _, g := range db.DBParameterGroups {
+		if aws.StringValue(g.ParameterApplyStatus) == "pending-reboot" {
+			pending = append(pending, fmt.Sprintf("parameter group %s pending reboot", aws.StringValue(g.DBParameterGroupName)))
+		}
+	}
+	if len(pending) > 0 {
+		return "pending: " + strings.Join(pending, ", ")
+	}
+	return ""
+}
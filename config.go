@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-ini/ini"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// applyConfig looks for configFlag in args and, if it is present, loads the
+// named INI file. Each key in the file sets the default value of the flag of
+// the same name, so that flags given on the command line take precedence.
+// Repeatable flags may be given by repeating the key.
+func applyConfig(app *kingpin.Application, configFlag *kingpin.FlagClause, args []string) error {
+	context, err := app.ParseContext(args)
+	if err != nil {
+		// Leave command-line errors for Parse to report.
+		return nil
+	}
+	var path string
+	for _, element := range context.Elements {
+		if element.Clause == configFlag && element.Value != nil {
+			path = *element.Value
+		}
+	}
+	if path == "" {
+		return nil
+	}
+
+	cfg, err := ini.ShadowLoad(path)
+	if err != nil {
+		return err
+	}
+	for _, key := range cfg.Section("").Keys() {
+		flag := app.GetFlag(key.Name())
+		if flag == nil || flag == configFlag || flag == app.HelpFlag {
+			return fmt.Errorf("%s: unknown flag: %s", path, key.Name())
+		}
+		flag.Default(key.ValueWithShadows()...)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// envFileLines describes the outcome of a wait as KEY=value lines in the
+// format understood by CI systems such as GitHub Actions ($GITHUB_ENV).
+func envFileLines(status string, db *rds.DBInstance, elapsed string) []string {
+	var port string
+	address, portNum := endpoint(db)
+	if portNum != 0 {
+		port = strconv.FormatInt(portNum, 10)
+	}
+	return []string{
+		"RDS_STATUS=" + status,
+		"RDS_ENDPOINT=" + address,
+		"RDS_PORT=" + port,
+		"RDS_ELAPSED=" + elapsed,
+	}
+}
+
+// appendEnvFile appends lines to the file at path, creating it if necessary.
+func appendEnvFile(path string, lines []string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(f, line); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
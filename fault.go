@@ -0,0 +1,28 @@
+//go:build faultinject
+// +build faultinject
+
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// Fault injection exercises the retry machinery in integration tests. It is
+// compiled in only with the faultinject build tag.
+
+var injectErrors int64
+
+func registerFaultFlags(app *kingpin.Application) {
+	app.Flag("inject-errors", "Fail the first N instance descriptions with a synthetic throttling error.").Hidden().PlaceHolder("N").Int64Var(&injectErrors)
+}
+
+// injectedFault returns a synthetic error while injected faults remain.
+func injectedFault() error {
+	if atomic.AddInt64(&injectErrors, -1) < 0 {
+		return nil
+	}
+	return awserr.NewRequestFailure(awserr.New("Throttling", "injected fault", nil), 400, "")
+}
@@ -0,0 +1,12 @@
+//go:build !faultinject
+// +build !faultinject
+
+package main
+
+import kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+func registerFaultFlags(app *kingpin.Application) {}
+
+func injectedFault() error {
+	return nil
+}
@@ -0,0 +1,119 @@
+//go:build sqlhealthcheck
+// +build sqlhealthcheck
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// The SQL healthcheck pulls in database drivers, so it is compiled in only
+// with the sqlhealthcheck build tag.
+
+const healthcheckRetryInterval = 5 * time.Second
+
+var (
+	healthcheckDSN     string
+	healthcheckTimeout time.Duration
+	warmupQueries      int
+	warmupQuery        string
+)
+
+func registerHealthcheckFlags(app *kingpin.Application) {
+	app.Flag("healthcheck-dsn", "Once available, connect to the instance using DSN and keep waiting until SELECT 1 succeeds. The driver is chosen from the engine reported by RDS.").PlaceHolder("DSN").StringVar(&healthcheckDSN)
+	app.Flag("healthcheck-timeout", "Fail if the healthcheck query has not succeeded within this long.").Default("5m").DurationVar(&healthcheckTimeout)
+	app.Flag("warmup-queries", "Once the healthcheck query succeeds, run the warmup statement N times before declaring the instance ready.").PlaceHolder("N").IntVar(&warmupQueries)
+	app.Flag("warmup-query", "Statement run by --warmup-queries.").Default("SELECT 1").PlaceHolder("SQL").StringVar(&warmupQuery)
+}
+
+// sqlDriver returns the name of the database/sql driver for an RDS engine.
+func sqlDriver(engine string) (string, error) {
+	switch {
+	case strings.HasPrefix(engine, "aurora-postgresql"), strings.HasPrefix(engine, "postgres"):
+		return "postgres", nil
+	case engine == "aurora", strings.HasPrefix(engine, "aurora-mysql"), strings.HasPrefix(engine, "mysql"), strings.HasPrefix(engine, "mariadb"):
+		return "mysql", nil
+	}
+	return "", fmt.Errorf("no healthcheck driver for engine: %s", engine)
+}
+
+// healthcheck blocks until SELECT 1 succeeds against the instance.
+func healthcheck(ctx context.Context, logger *log.Logger, db *rds.DBInstance) error {
+	if healthcheckDSN == "" {
+		return nil
+	}
+	driver, err := sqlDriver(aws.StringValue(db.Engine))
+	if err != nil {
+		return err
+	}
+	conn, err := sql.Open(driver, healthcheckDSN)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := waitForQuery(ctx, logger, conn); err != nil {
+		return err
+	}
+	return warmup(ctx, logger, conn)
+}
+
+// waitForQuery blocks until SELECT 1 succeeds on conn, or the healthcheck
+// timeout elapses.
+func waitForQuery(ctx context.Context, logger *log.Logger, conn *sql.DB) error {
+	ctx, cancel := context.WithTimeout(ctx, healthcheckTimeout)
+	defer cancel()
+	for {
+		var one int
+		err := conn.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+		if err == nil {
+			logger.Printf("healthcheck query succeeded")
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("healthcheck query did not succeed within %s: %v", healthcheckTimeout, err)
+		}
+		logger.Printf("healthcheck query failed: %v", err)
+
+		select {
+		case <-time.After(healthcheckRetryInterval):
+		case <-ctx.Done():
+			return fmt.Errorf("healthcheck query did not succeed within %s: %v", healthcheckTimeout, err)
+		}
+	}
+}
+
+// warmup runs the warmup statement the requested number of times, so that
+// the instance's caches are primed before it is declared ready.
+func warmup(ctx context.Context, logger *log.Logger, conn *sql.DB) error {
+	if warmupQueries <= 0 {
+		return nil
+	}
+	start := time.Now()
+	for i := 0; i < warmupQueries; i++ {
+		rows, err := conn.QueryContext(ctx, warmupQuery)
+		if err != nil {
+			return fmt.Errorf("warmup query %d of %d: %v", i+1, warmupQueries, err)
+		}
+		for rows.Next() {
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("warmup query %d of %d: %v", i+1, warmupQueries, err)
+		}
+	}
+	logger.Printf("ran %d warmup queries in %s", warmupQueries, time.Since(start).Round(time.Millisecond))
+	return nil
+}
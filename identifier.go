@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// checkIdentifier reports whether id satisfies the RDS naming rules for
+// instance and cluster identifiers, so that a typo fails before any AWS call
+// is made. RDS treats identifiers case-insensitively and stores them in
+// lowercase, so uppercase letters are accepted.
+func checkIdentifier(id string) error {
+	id = strings.ToLower(id)
+	switch {
+	case len(id) < 1 || len(id) > 63:
+		return errors.New("must be 1 to 63 characters long")
+	case id[0] < 'a' || id[0] > 'z':
+		return errors.New("must start with a letter")
+	case strings.HasSuffix(id, "-"):
+		return errors.New("must not end with a hyphen")
+	case strings.Contains(id, "--"):
+		return errors.New("must not contain two consecutive hyphens")
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return errors.New("must contain only letters, digits and hyphens")
+		}
+	}
+	return nil
+}
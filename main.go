@@ -2,93 +2,278 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
 	"github.com/aws/aws-sdk-go/service/rds"
-	"golang.org/x/sys/unix"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
 var (
 	sess *session.Session
 	svc  *rds.RDS
+	cw   *cloudwatch.CloudWatch
+
+	rngMu sync.Mutex
+	rng   = rand.New(rand.NewSource(time.Now().UnixNano()))
 )
 
 func init() {
 	sess = session.Must(session.NewSession())
 	svc = rds.New(sess)
+	cw = cloudwatch.New(sess)
+	addRetryHandlers(&svc.Handlers, svc.Retryer)
+	addRetryHandlers(&cw.Handlers, cw.Retryer)
 }
 
-func delay() time.Duration {
-	return 25*time.Second + time.Duration(rand.Int63n(5000))*time.Millisecond
+// jitter returns a random duration in [0, max).
+func jitter(max time.Duration) time.Duration {
+	rngMu.Lock()
+	defer rngMu.Unlock()
+	return time.Duration(rng.Int63n(int64(max)))
 }
 
-func dbStatus(ctx context.Context, instanceID string) (string, error) {
-	req := &rds.DescribeDBInstancesInput{
-		DBInstanceIdentifier: aws.String(instanceID),
-		MaxRecords:           aws.Int64(20),
-	}
-	res, err := svc.DescribeDBInstancesWithContext(ctx, req)
-	if err != nil {
-		return "", err
-	}
+const defaultPollInterval = 25 * time.Second
 
-	if len(res.DBInstances) == 0 {
-		return "", fmt.Errorf("no such instance: %s", instanceID)
-	}
-	if len(res.DBInstances) > 1 {
-		return "", errors.New("DescribeDBInstances query matched multiple instances")
-	}
-	status := res.DBInstances[0].DBInstanceStatus
-	if status == nil {
-		return "", fmt.Errorf("no status for instance: %s", instanceID)
+// delay returns interval plus up to 20% random jitter.
+func delay(interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return 0
 	}
-	return *status, nil
+	return interval + jitter(interval/5+1)
 }
 
-func waitUntilDBAvailable(ctx context.Context, instanceID string) error {
-	for {
-		status, err := dbStatus(ctx, instanceID)
-		if err != nil {
-			return err
-		}
-		log.Printf("instance status: %s", status)
-		if status == "available" {
-			break
-		}
-
-		select {
-		case <-time.After(delay()):
-		case <-ctx.Done():
-			return ctx.Err()
-		}
+// formatElapsed renders d rounded to the second, either as a duration string
+// such as 4m12s or, if seconds is set, as a plain number of seconds.
+func formatElapsed(d time.Duration, seconds bool) string {
+	d = d.Round(time.Second)
+	if seconds {
+		return strconv.FormatInt(int64(d/time.Second), 10)
 	}
-	return nil
+	return d.String()
 }
 
 func main() {
 	var (
-		app          = kingpin.New("wait-until-aws-rds-available", "Block until an AWS RDS instance transitions into available state.")
-		instanceID   = app.Arg("db-instance-identifier", "AWS RDS DBInstanceIdentifier of the instance to watch.").Required().String()
-		ignoreErrors = app.Flag("ignore-aws-errors", "Retry on errors from the AWS SDK.").Bool()
+		app            = kingpin.New("wait-until-aws-rds-available", "Block until an AWS RDS instance transitions into available state.")
+		instanceID     = app.Arg("db-instance-identifier", "AWS RDS DBInstanceIdentifier of the instance to watch.").String()
+		checkOnly      = app.Flag("check", "Poll the instance once, print its status and exit: 0 if it is in a target status, 1 otherwise.").Bool()
+		codeOnly       = app.Flag("status-code-only", "With --check, print nothing and exit with a code identifying the status (see --print-status-codes).").Bool()
+		validateID     = app.Flag("validate-identifier", "Check the identifier against the RDS naming rules before making any AWS call. Use --no-validate-identifier to skip the check.").Default("true").Bool()
+		ignoreErrors   = app.Flag("ignore-aws-errors", "Retry on errors from the AWS SDK. Server-side (5xx) errors are retried regardless, up to 5 times in a row unless --max-attempts is given.").Bool()
+		maxAttempts    = app.Flag("max-attempts", "Give up after this many failed attempts when retrying errors (0 means no limit).").PlaceHolder("N").Int()
+		minUptime      = app.Flag("min-uptime", "Once available, keep waiting until the instance was created at least this long ago.").PlaceHolder("DURATION").Duration()
+		waitSubnets    = app.Flag("wait-subnet-group", "Once available, keep waiting until the instance's DB subnet group status is Complete.").Bool()
+		expectIAMAuth  = app.Flag("expect-iam-auth", "Once available, keep waiting until IAM database authentication is enabled on the instance.").Bool()
+		expectClass    = app.Flag("expect-instance-class", "Once available, keep waiting until the instance class is CLASS (e.g. after scaling).").PlaceHolder("CLASS").String()
+		expectPI       = app.Flag("expect-performance-insights", "Once available, keep waiting until Performance Insights is enabled on the instance.").Bool()
+		expectDelProt  = app.Flag("expect-deletion-protection", "Once available, keep waiting until deletion protection is enabled (true) or disabled (false) on the instance.").PlaceHolder("BOOL").Enum("true", "false")
+		waitPromotion  = app.Flag("wait-promotion", "Once available, keep waiting until the instance is no longer a read replica (i.e. its promotion has completed).").Bool()
+		waitPatch      = app.Flag("wait-patch-complete", "Once available, keep waiting until the instance has no pending modifications and no parameter changes awaiting a reboot.").Bool()
+		waitDNS        = app.Flag("poll-until-endpoint-dns-resolves", "Once available, keep waiting until the instance endpoint address resolves.").Bool()
+		waitPort       = app.Flag("wait-endpoint-port", "Once available, keep waiting until the instance endpoint accepts TCP connections.").Bool()
+		watchCluster   = app.Flag("watch-all-in-cluster", "Treat the argument as a DBClusterIdentifier and wait until every member instance of the cluster is available.").Bool()
+		clusterOnly    = app.Flag("cluster", "Treat the argument as a DBClusterIdentifier and wait until the cluster reaches a target status, without waiting for its member instances (for that, use --wait-cluster-then-instances instead).").Bool()
+		clusterFirst   = app.Flag("wait-cluster-then-instances", "Treat the argument as a DBClusterIdentifier; wait until the cluster reaches a target status, then until every member instance does. Implies --watch-all-in-cluster.").Bool()
+		clusterPhase   = app.Flag("phase-cluster-timeout", "With --cluster or --wait-cluster-then-instances, fail if the cluster has not reached a target status within this long.").PlaceHolder("DURATION").Duration()
+		membersPhase   = app.Flag("phase-members-timeout", "With --wait-cluster-then-instances, fail if the member instances are not all available within this long of the members phase starting.").PlaceHolder("DURATION").Duration()
+		waitEndpoint   = app.Flag("wait-endpoint", "With --cluster or --watch-all-in-cluster, once the wait is otherwise complete, keep waiting until the cluster's writer endpoint, reader endpoint or both resolve and accept connections.").PlaceHolder("writer|reader|both").Enum("writer", "reader", "both")
+		alarms         = app.Flag("wait-alarm-ok", "Once the wait is otherwise complete, keep waiting until the named CloudWatch alarm is in the OK state. May be repeated.").PlaceHolder("ALARM").Strings()
+		predicate      = app.Flag("predicate-exec", "Once a target status is reached and every other condition holds, keep waiting until PROGRAM, run on each such poll with the instance description as JSON on its standard input, exits with status 0.").PlaceHolder("PROGRAM").String()
+		predicateArgs  = app.Flag("predicate-arg", "Pass ARG to the --predicate-exec program. May be repeated.").PlaceHolder("ARG").Strings()
+		bestEffort     = app.Flag("best-effort-aux", "Warn and carry on, rather than fail, when permission is denied for the auxiliary calls made by --wait-alarm-ok (the gate is skipped) and --tag (instances whose tags cannot be read are not matched).").Bool()
+		verifyFailover = app.Flag("verify-failover", "Fail unless the instance is in a different availability zone once available than when first observed (e.g. after a reboot with failover).").Bool()
+		tags           = app.Flag("tag", "Instead of naming an instance, wait until every instance carrying all of the given tags is available. May be repeated.").PlaceHolder("KEY=VALUE").StringMap()
+		regionalIDs    = app.Flag("instance", "Instead of naming an instance, wait for the instance ID in REGION. May be repeated, including across regions.").PlaceHolder("REGION/ID").Strings()
+		instancesFile  = app.Flag("instances-file", "Instead of naming an instance, wait for every instance listed in FILE, one ID or REGION/ID per line. Text from # to the end of a line is a comment; blank lines are ignored.").PlaceHolder("FILE").String()
+		idRegex        = app.Flag("identifier-regex", "Instead of naming an instance, wait for the instance whose identifier matches REGEX.").PlaceHolder("REGEX").Regexp()
+		idPrefix       = app.Flag("identifier-prefix", "Instead of naming an instance, wait for the instance whose identifier starts with PREFIX.").PlaceHolder("PREFIX").String()
+		onMultiple     = app.Flag("on-multiple", "What to do when --identifier-regex or --identifier-prefix matches more than one instance: fail (error) or wait for every match (all).").Default("error").Enum("error", "all")
+		envFile        = app.Flag("env-file", "On success, append RDS_STATUS, RDS_ENDPOINT, RDS_PORT and RDS_ELAPSED lines to FILE (e.g. $GITHUB_ENV).").PlaceHolder("FILE").String()
+		envOnFailure   = app.Flag("env-file-on-failure", "Also write --env-file when the wait fails.").Bool()
+		targetStatuses = app.Flag("target-status", "Wait until the instance, or the cluster with --cluster or --wait-cluster-then-instances, reaches STATUS instead of available. May be repeated to accept any of several statuses.").PlaceHolder("STATUS").Strings()
+		failStatuses   = app.Flag("fail-status", "Fail as soon as the instance enters STATUS. May be repeated. Takes precedence over every other status classification.").PlaceHolder("STATUS").Strings()
+		untilNot       = app.Flag("until-not-status", "Succeed as soon as the instance is in any status other than STATUS. With --target-status, first wait for the instance to leave STATUS, then for it to reach a target.").PlaceHolder("STATUS").String()
+		waitBackup     = app.Flag("wait-out-backup", "If the instance is seen backing up, wait until it returns to available specifically, logging when the backup starts and ends.").Bool()
+		requireTrans   = app.Flag("require-transition", "Fail if the instance is already in a target status when first polled, i.e. if nothing was waited for (e.g. the wrong instance was named).").Bool()
+		failTerminal   = app.Flag("fail-on-terminal-status", "Fail as soon as the instance enters a status it will not leave without operator intervention (e.g. storage-full, incompatible-parameters; see --list-statuses). By default every status is waited through.").Bool()
+		extraTransient = app.Flag("extra-transient-status", "With --fail-on-terminal-status, wait through STATUS rather than failing on it. May be repeated.").PlaceHolder("STATUS").Strings()
+		pollOffset     = app.Flag("poll-offset", "Sleep for a random duration of up to this long before the first poll, so that waiters launched together do not poll in lockstep.").PlaceHolder("DURATION").Duration()
+		statusPhase    = app.Flag("phase-status-timeout", "Fail if the instance has not reached a target status, with all conditions satisfied, within this long.").PlaceHolder("DURATION").Duration()
+		endpointPhase  = app.Flag("phase-endpoint-timeout", "Fail if the follow-up checks run once the instance or cluster is ready (e.g. --wait-endpoint-port, --poll-until-endpoint-dns-resolves, --wait-endpoint) have not passed within this long.").PlaceHolder("DURATION").Duration()
+		maxNoChange    = app.Flag("max-no-change", "Fail if the instance stays in the same status, other than a target, for longer than this. A --status-timeout for that status takes precedence. The timer restarts on every status change.").PlaceHolder("DURATION").Duration()
+		pollTimeout    = app.Flag("poll-timeout", "Abandon any single poll, including its endpoint checks, that takes longer than this and carry on with the next one.").PlaceHolder("DURATION").Duration()
+		runID          = app.Flag("correlation-id", "Identify this run by ID in every log line and JSON event. Defaults to a random identifier.").PlaceHolder("ID").String()
+		quietUntil     = app.Flag("quiet-until-change", "Hold back the instance's own log lines (polls, conditions, follow-up checks) while its status is unchanged from the first poll; once it changes, log every poll through to completion. Lines about the run as a whole (retries, warnings, errors, the final summary) are logged regardless.").Bool()
+		color          = app.Flag("color", "Colour status transitions when stderr is a terminal. Use --no-color, or set NO_COLOR, to disable.").Default("true").Bool()
+		printARN       = app.Flag("print-arn", "Include the instance ARN and DbiResourceId in the final summary line. They are always included in the JSON summary.").Bool()
+		jsonOutput     = app.Flag("json", "Write machine-readable JSON events to stdout, one per line. Logs continue to go to stderr.").Bool()
+		seconds        = app.Flag("seconds", "Report elapsed times as a plain number of seconds.").Bool()
+		sdkRetries     = app.Flag("sdk-max-retries", "Let the AWS SDK retry each failed request up to N times before the error reaches the tool's own retry loop (negative means the SDK default of 3).").Default("-1").PlaceHolder("N").Int()
+		sdkRetryMode   = app.Flag("sdk-retry-mode", "How the AWS SDK backs off between its retries: standard exponential backoff, or adaptive, which also slows down further while requests are being throttled.").PlaceHolder("standard|adaptive").Enum("standard", "adaptive")
+		maxIdentical   = app.Flag("max-identical-errors", "Give up, even with --ignore-aws-errors, once the same AWS error code has been seen this many times in a row with no progress in between (0 means no limit).").Default("10").PlaceHolder("N").Int()
+		retryNotFound  = app.Flag("retry-on-not-found", "Keep waiting if the instance does not exist yet (e.g. immediately after create-db-instance). Once the instance has been seen, its disappearance is still fatal.").Bool()
+		statusTimeouts = durationMap{}
+		pollIntervals  = &pollIntervals{global: defaultPollInterval, byStatus: durationMap{}}
+		seed           = &optionalInt64{}
 	)
+	app.Flag("poll-interval", "Poll every DURATION, or every DURATION while the instance is in STATUS. May be repeated.").PlaceHolder("[STATUS=]DURATION").SetValue(pollIntervals)
+	app.Flag("status-timeout", "Fail if the instance remains in STATUS for longer than DURATION. May be repeated.").PlaceHolder("STATUS=DURATION").SetValue(statusTimeouts)
+	app.Flag("seed", "Seed the random number generator used for jitter and offsets.").Hidden().SetValue(seed)
+
+	app.Flag("list-statuses", "List the instance statuses known to the tool, grouped by how they are handled, and exit. Unlisted statuses are waited through.").PreAction(func(*kingpin.ParseContext) error {
+		printStatuses(os.Stdout)
+		os.Exit(0)
+		return nil
+	}).Bool()
+
+	app.Flag("print-status-codes", "List the exit codes used by --status-code-only and exit.").PreAction(func(*kingpin.ParseContext) error {
+		printStatusCodes(os.Stdout)
+		os.Exit(0)
+		return nil
+	}).Bool()
+
+	registerHealthcheckFlags(app)
+	registerFaultFlags(app)
+
+	configFlag := app.Flag("config", "Read default flag values from an INI file of flag-name = value lines. Flags given on the command line take precedence.").PlaceHolder("FILE")
+	configFlag.String()
 
+	app.FatalIfError(applyConfig(app, configFlag, os.Args[1:]), "config")
 	kingpin.MustParse(app.Parse(os.Args[1:]))
+	if *clusterOnly && (*watchCluster || *clusterFirst) {
+		app.Fatalf("--cluster cannot be combined with --watch-all-in-cluster or --wait-cluster-then-instances; use --wait-cluster-then-instances alone to wait for the cluster and then its members, try --help")
+	}
+	if *clusterFirst {
+		*watchCluster = true
+	}
+	// Instances listed with --instance and --instances-file are waited for
+	// together, each in its own region.
+	listed := *regionalIDs
+	for _, entry := range listed {
+		_, id, err := parseInstanceEntry(entry, false)
+		if err == nil && *validateID {
+			err = checkIdentifier(id)
+		}
+		if err != nil {
+			app.Fatalf("invalid --instance %q: %v", entry, err)
+		}
+	}
+	if *instancesFile != "" {
+		entries, err := readInstancesFile(*instancesFile)
+		app.FatalIfError(err, "instances-file")
+		for _, entry := range entries {
+			_, id, err := parseInstanceEntry(entry, true)
+			if err == nil && *validateID {
+				err = checkIdentifier(id)
+			}
+			if err != nil {
+				app.Fatalf("%s: invalid entry %q: %v", *instancesFile, entry, err)
+			}
+		}
+		listed = append(listed, entries...)
+	}
+
+	byPattern := *idRegex != nil || *idPrefix != ""
+	regional := len(listed) > 0
+	// Instance conditions and follow-up checks have no equivalent when
+	// waiting on a cluster's own status.
+	var instanceOnly string
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"min-uptime", *minUptime > 0},
+		{"wait-subnet-group", *waitSubnets},
+		{"expect-iam-auth", *expectIAMAuth},
+		{"expect-instance-class", *expectClass != ""},
+		{"expect-performance-insights", *expectPI},
+		{"expect-deletion-protection", *expectDelProt != ""},
+		{"wait-promotion", *waitPromotion},
+		{"wait-patch-complete", *waitPatch},
+		{"poll-until-endpoint-dns-resolves", *waitDNS},
+		{"wait-endpoint-port", *waitPort},
+		{"predicate-exec", *predicate != ""},
+		{"verify-failover", *verifyFailover},
+		{"until-not-status", *untilNot != ""},
+		{"wait-out-backup", *waitBackup},
+		{"require-transition", *requireTrans},
+		{"phase-status-timeout", *statusPhase > 0},
+		{"retry-on-not-found", *retryNotFound},
+		{"env-file", *envFile != ""},
+	} {
+		if f.set && instanceOnly == "" {
+			instanceOnly = f.name
+		}
+	}
+	switch {
+	case regional && (*instanceID != "" || *watchCluster || *clusterOnly || len(*tags) > 0 || byPattern):
+		app.Fatalf("--instance and --instances-file cannot be combined with db-instance-identifier, --cluster, --watch-all-in-cluster, --tag or identifier matching, try --help")
+	case len(*tags) > 0 && (*instanceID != "" || *watchCluster):
+		app.Fatalf("--tag cannot be combined with db-instance-identifier or --watch-all-in-cluster, try --help")
+	case *idRegex != nil && *idPrefix != "":
+		app.Fatalf("--identifier-regex cannot be combined with --identifier-prefix, try --help")
+	case byPattern && (*instanceID != "" || *watchCluster || len(*tags) > 0):
+		app.Fatalf("--identifier-regex and --identifier-prefix cannot be combined with db-instance-identifier, --watch-all-in-cluster or --tag, try --help")
+	case len(*tags) == 0 && !byPattern && !regional && *instanceID == "":
+		app.Fatalf("required argument 'db-instance-identifier' not provided, try --help")
+	case *clusterOnly && (len(*tags) > 0 || byPattern):
+		app.Fatalf("--cluster cannot be combined with --tag or identifier matching, try --help")
+	case *clusterOnly && instanceOnly != "":
+		app.Fatalf("--%s applies to instances and cannot be combined with --cluster, try --help", instanceOnly)
+	case *waitEndpoint != "" && !*watchCluster && !*clusterOnly:
+		app.Fatalf("--wait-endpoint requires --cluster or --watch-all-in-cluster, try --help")
+	case *checkOnly && (*instanceID == "" || *watchCluster || *clusterOnly):
+		app.Fatalf("--check requires db-instance-identifier and works on a single instance, try --help")
+	case *codeOnly && !*checkOnly:
+		app.Fatalf("--status-code-only requires --check, try --help")
+	case *clusterPhase > 0 && !*clusterFirst && !*clusterOnly:
+		app.Fatalf("--phase-cluster-timeout requires --cluster or --wait-cluster-then-instances, try --help")
+	case *membersPhase > 0 && !*clusterFirst:
+		app.Fatalf("--phase-members-timeout requires --wait-cluster-then-instances, try --help")
+	}
+	if *instanceID != "" && *validateID {
+		if err := checkIdentifier(*instanceID); err != nil {
+			app.Fatalf("invalid identifier %q: %v (use --no-validate-identifier to skip this check)", *instanceID, err)
+		}
+	}
+	statuses, err := newStatusClassifier(*targetStatuses, *failStatuses, *failTerminal, *extraTransient, *untilNot)
+	app.FatalIfError(err, "")
+
+	// Every log line and event carries the run identifier, so that the
+	// output of one invocation can be picked out of an aggregated log.
+	if *runID == "" {
+		*runID = newRunID()
+	}
+	log.SetFlags(log.LstdFlags | log.Lmsgprefix)
+	log.SetPrefix("run=" + *runID + " ")
 
+	if *jsonOutput {
+		app.FatalIfError(checkSeparateStreams(), "")
+		events = newEmitter(os.Stdout, *runID)
+	}
+	if seed.set {
+		rng.Seed(seed.value)
+	}
+	if *sdkRetries >= 0 || *sdkRetryMode != "" {
+		configureSDK(*sdkRetries, *sdkRetryMode)
+	}
+	start := time.Now()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, unix.SIGINT, unix.SIGTERM)
+	signal.Notify(signals, terminationSignals...)
 	go func() {
 		select {
 		case <-ctx.Done():
@@ -98,34 +283,278 @@ func main() {
 		}
 	}()
 
-	var err error
-retry:
-	for {
-		err = waitUntilDBAvailable(ctx, *instanceID)
-		if err == nil {
-			break retry
-		}
-		switch awsErr := err.(type) {
-		case awserr.Error:
-			if awsErr.Code() == "RequestCanceled" {
-				break retry
+	if *checkOnly {
+		if *codeOnly {
+			// The exit code is the only output, so SDK retry and other
+			// log lines are dropped too.
+			log.SetOutput(io.Discard)
+		}
+		code := check(ctx, os.Stdout, *instanceID, statuses, *pollTimeout, *codeOnly)
+		cancel()
+		os.Exit(code)
+	}
+
+	// Transitions are coloured only when a person is likely to be watching.
+	colorize := *color && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stderr)
+	newWaiter := func(instanceID string, logger *log.Logger) *waiter {
+		// With --quiet-until-change, the waiter's log is held shut until
+		// the instance first changes status.
+		gate := &logGate{w: logger.Writer(), open: !*quietUntil}
+		logger = log.New(gate, logger.Prefix(), logger.Flags())
+		w := &waiter{
+			instanceID: instanceID,
+			svc:        svc,
+			logger:     logger,
+			waitDNS:    *waitDNS,
+			waitPort:   *waitPort,
+
+			statusTimeouts: statusTimeouts,
+			maxNoChange:    *maxNoChange,
+			pollIntervals:  pollIntervals,
+			pollTimeout:    *pollTimeout,
+			statuses:       statuses,
+			retryNotFound:  *retryNotFound,
+			verifyFailover: *verifyFailover,
+			predicate:      *predicate,
+			predicateArgs:  *predicateArgs,
+
+			requireTransition: *requireTrans,
+			waitOutBackup:     *waitBackup,
+
+			statusPhaseTimeout:   *statusPhase,
+			endpointPhaseTimeout: *endpointPhase,
+		}
+		w.onStatusChange = func(old, new string) {
+			gate.open = true
+			if colorize {
+				old, new = colorStatus(statuses, old), colorStatus(statuses, new)
+			}
+			logger.Printf("%s status changed: %s -> %s", w.kind(), old, new)
+		}
+		w.onDone = func() {
+			ev := event{Event: "succeeded", Instance: w.label(), Status: w.status, Elapsed: formatElapsed(w.elapsed, *seconds)}
+			if w.err != nil {
+				ev.Event, ev.Error = "failed", w.err.Error()
 			}
-		default:
-			break retry
+			events.emit(ev)
 		}
-		if !*ignoreErrors {
-			break retry
+		if *minUptime > 0 {
+			w.conditions = append(w.conditions, minUptimeCondition(*minUptime))
 		}
-		log.Printf("retrying: %v", err)
+		if *waitSubnets {
+			w.conditions = append(w.conditions, subnetGroupCondition)
+		}
+		if *expectIAMAuth {
+			w.conditions = append(w.conditions, iamAuthCondition)
+		}
+		if *expectClass != "" {
+			w.conditions = append(w.conditions, instanceClassCondition(*expectClass))
+		}
+		if *expectPI {
+			w.conditions = append(w.conditions, performanceInsightsCondition)
+		}
+		if *expectDelProt != "" {
+			w.conditions = append(w.conditions, deletionProtectionCondition(*expectDelProt == "true"))
+		}
+		if *waitPromotion {
+			w.conditions = append(w.conditions, promotionCondition)
+		}
+		if *waitPatch {
+			w.conditions = append(w.conditions, patchCondition)
+		}
+		return w
+	}
+	w := newWaiter(*instanceID, newLogger(""))
+	w.cluster = *clusterOnly || *clusterFirst
 
+	if *pollOffset > 0 {
+		offset := jitter(*pollOffset)
+		log.Printf("sleeping %s before first poll", offset.Round(time.Millisecond))
 		select {
-		case <-time.After(delay()):
+		case <-time.After(offset):
 		case <-ctx.Done():
 			err = ctx.Err()
-			break retry
 		}
 	}
+	policy := retryPolicy{ignoreErrors: *ignoreErrors, maxAttempts: *maxAttempts, interval: pollIntervals.global, breakAfter: *maxIdentical}
+
+	// In cluster, tag and pattern modes, resolve the set of instances to
+	// watch.
+	var (
+		instances []string
+		members   []*rds.DBClusterMember
+		waiters   []*waiter
+	)
+	waitCluster := func() error {
+		return phase(ctx, "cluster", time.Now(), *clusterPhase, func(ctx context.Context) error {
+			return policy.withProgress(w.describeCount).retry(ctx, func() error {
+				return w.waitCluster(ctx)
+			})
+		})
+	}
+	waitClusterEndpoints := func() error {
+		return phase(ctx, "endpoint", time.Now(), *endpointPhase, func(ctx context.Context) error {
+			return policy.retry(ctx, func() error {
+				cluster, err := describeDBCluster(ctx, *instanceID)
+				if err != nil {
+					return err
+				}
+				return waitForClusterEndpoints(ctx, newLogger(""), cluster, *waitEndpoint)
+			})
+		})
+	}
+	if err == nil {
+		switch {
+		case *watchCluster:
+			if *clusterFirst {
+				log.Printf("phase: cluster")
+				err = waitCluster()
+				if err == nil {
+					log.Printf("phase: members")
+				}
+			}
+			if err == nil {
+				err = policy.retry(ctx, func() (err error) {
+					members, err = clusterMembers(ctx, *instanceID)
+					return err
+				})
+				instances = memberIDs(members)
+			}
+		case len(*tags) > 0:
+			err = policy.retry(ctx, func() (err error) {
+				instances, err = instancesByTag(ctx, svc, *tags, *bestEffort)
+				return err
+			})
+		case regional:
+			instances = listed
+		case byPattern:
+			pattern, match := *idPrefix, func(id string) bool { return strings.HasPrefix(id, *idPrefix) }
+			if *idRegex != nil {
+				pattern, match = (*idRegex).String(), (*idRegex).MatchString
+			}
+			err = policy.retry(ctx, func() (err error) {
+				instances, err = instancesByIdentifier(ctx, svc, match)
+				return err
+			})
+			switch {
+			case err != nil:
+			case len(instances) == 0:
+				err = fmt.Errorf("no instances match: %s", pattern)
+			case len(instances) == 1:
+				// A unique match is waited for as if it had been named.
+				*instanceID, w.instanceID = instances[0], instances[0]
+				instances = nil
+			case *onMultiple == "error":
+				err = fmt.Errorf("%d instances match %s: %v (use --on-multiple=all to wait for all of them)", len(instances), pattern, instances)
+				instances = nil
+			}
+		}
+	}
+	if err == nil {
+		if instances != nil {
+			log.Printf("watching instances: %v", instances)
+			for _, label := range instances {
+				id, region := label, ""
+				if regional {
+					region, id, _ = parseInstanceEntry(label, true)
+				}
+				w := newWaiter(id, newLogger(label+": "))
+				w.region, w.svc = region, rdsClient(region)
+				waiters = append(waiters, w)
+			}
+			err = phase(ctx, "members", time.Now(), *membersPhase, func(ctx context.Context) error {
+				return waitAll(ctx, waiters, policy)
+			})
+			if err == nil && *waitEndpoint != "" {
+				err = waitClusterEndpoints()
+			}
+		} else if *clusterOnly {
+			err = waitCluster()
+			if err == nil && *waitEndpoint != "" {
+				err = waitClusterEndpoints()
+			}
+		} else {
+			err = policy.withProgress(w.describeCount).retry(ctx, func() error {
+				return w.wait(ctx)
+			})
+		}
+	}
+	if err == nil && len(*alarms) > 0 {
+		err = policy.retry(ctx, func() error {
+			err := waitForAlarmsOK(ctx, newLogger(""), *alarms, pollIntervals.global)
+			if *bestEffort && isAccessDenied(err) {
+				log.Printf("warning: skipping --wait-alarm-ok: %v", err)
+				return nil
+			}
+			return err
+		})
+	}
+
+	elapsed := formatElapsed(time.Since(start), *seconds)
+	status := w.status
+	if instances != nil {
+		status = commonStatus(waiters)
+	}
+	if err == nil {
+		log.Printf("%s after %s", status, elapsed)
+	}
+	if *envFile != "" && (err == nil || *envOnFailure) {
+		lines := envFileLines(status, w.instance, elapsed)
+		if envErr := appendEnvFile(*envFile, lines); envErr != nil {
+			if err == nil {
+				err = envErr
+			} else {
+				log.Printf("writing env file: %v", envErr)
+			}
+		}
+	}
+
+	summary := event{Event: "summary", Result: "success", Status: status, Elapsed: elapsed}
+	if instances == nil {
+		summary.Instance = *instanceID
+		summary.Endpoint, summary.Port = endpoint(w.instance)
+		summary.ARN, summary.Resource = identity(w.instance)
+	}
+	if members != nil && events != nil {
+		// Roles may have changed during the wait (e.g. after a failover).
+		if current, descErr := clusterMembers(ctx, *instanceID); descErr == nil {
+			members = current
+		}
+		summary.Members = memberStatuses(members, waiters)
+	}
+	if instances != nil {
+		summary.Results = instanceResults(waiters, *seconds)
+		printResults(os.Stderr, summary.Results)
+	}
+	polls := w.polls
+	if instances != nil {
+		// With --wait-cluster-then-instances, w polled the cluster.
+		if !w.cluster {
+			polls = pollStats{}
+		}
+		for _, w := range waiters {
+			polls.merge(w.polls)
+		}
+	}
+	summary.Polls = polls.count
+	summary.PollGaps = newPollGaps(polls, *seconds)
+	if err != nil {
+		summary.Result = "failure"
+		summary.Error = err.Error()
+	}
+	events.emit(summary)
+
+	// The final line is always written, in a stable key=value format, so
+	// that the outcome can be found without parsing the rest of the log.
+	summary.Instance = *instanceID
+	if instances != nil && (len(*tags) > 0 || byPattern || regional) {
+		summary.Instance = strings.Join(instances, ",")
+	}
+	if err != nil {
+		log.Print(err)
+	}
+	log.Print(summaryLine(summary, *printARN))
 	if err != nil {
-		log.Fatal(err)
+		os.Exit(1)
 	}
 }
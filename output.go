@@ -0,0 +1,289 @@
+package main
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// Machine-readable output is written to stdout as a stream of JSON events,
+// one per line. Human-readable logs always go to stderr.
+
+type event struct {
+	Time     time.Time `json:"time"`
+	Run      string    `json:"run,omitempty"`
+	Event    string    `json:"event"`
+	Result   string    `json:"result,omitempty"`
+	Instance string    `json:"instance,omitempty"`
+	Status   string    `json:"status,omitempty"`
+	Endpoint string    `json:"endpoint,omitempty"`
+	ARN      string    `json:"arn,omitempty"`
+	Resource string    `json:"resource_id,omitempty"`
+	Port     int64     `json:"port,omitempty"`
+	Elapsed  string    `json:"elapsed,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Polls    int       `json:"polls,omitempty"`
+	PollGaps *pollGaps `json:"poll_gaps,omitempty"`
+
+	Members []memberStatus   `json:"members,omitempty"`
+	Results []instanceResult `json:"results,omitempty"`
+}
+
+// pollGaps summarises the time between consecutive polls.
+type pollGaps struct {
+	Min string `json:"min"`
+	Max string `json:"max"`
+	Avg string `json:"avg"`
+}
+
+func newPollGaps(s pollStats, seconds bool) *pollGaps {
+	return &pollGaps{
+		Min: formatElapsed(s.min, seconds),
+		Max: formatElapsed(s.max, seconds),
+		Avg: formatElapsed(s.avg(), seconds),
+	}
+}
+
+// memberStatus describes a cluster member instance.
+type memberStatus struct {
+	Instance string `json:"instance"`
+	Role     string `json:"role"`
+	Writer   bool   `json:"writer"`
+	Status   string `json:"status,omitempty"`
+}
+
+// memberStatuses pairs each cluster member with the last status observed by
+// its waiter.
+func memberStatuses(members []*rds.DBClusterMember, waiters []*waiter) []memberStatus {
+	status := make(map[string]string, len(waiters))
+	for _, w := range waiters {
+		status[w.instanceID] = w.status
+	}
+	statuses := make([]memberStatus, len(members))
+	for i, m := range members {
+		ms := memberStatus{
+			Instance: *m.DBInstanceIdentifier,
+			Role:     "reader",
+			Writer:   aws.BoolValue(m.IsClusterWriter),
+			Status:   status[*m.DBInstanceIdentifier],
+		}
+		if ms.Writer {
+			ms.Role = "writer"
+		}
+		statuses[i] = ms
+	}
+	return statuses
+}
+
+// instanceResult is the outcome of waiting on one instance in
+// multi-instance mode.
+type instanceResult struct {
+	Instance string `json:"instance"`
+	Result   string `json:"result"`
+	Status   string `json:"status,omitempty"`
+	Elapsed  string `json:"elapsed"`
+	Error    string `json:"error,omitempty"`
+	ARN      string `json:"arn,omitempty"`
+	Resource string `json:"resource_id,omitempty"`
+}
+
+func instanceResults(waiters []*waiter, seconds bool) []instanceResult {
+	results := make([]instanceResult, len(waiters))
+	for i, w := range waiters {
+		r := instanceResult{
+			Instance: w.label(),
+			Result:   "success",
+			Status:   w.status,
+			Elapsed:  formatElapsed(w.elapsed, seconds),
+		}
+		r.ARN, r.Resource = identity(w.instance)
+		if w.err != nil {
+			r.Result = "failure"
+			r.Error = w.err.Error()
+		}
+		results[i] = r
+	}
+	return results
+}
+
+// printResults writes results to w as a table.
+func printResults(w io.Writer, results []instanceResult) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "INSTANCE\tRESULT\tSTATUS\tELAPSED\tERROR")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Instance, r.Result, r.Status, r.Elapsed, strings.ReplaceAll(r.Error, "\n", " "))
+	}
+	tw.Flush()
+}
+
+// identity returns the ARN and immutable resource ID of db, if known.
+func identity(db *rds.DBInstance) (string, string) {
+	if db == nil {
+		return "", ""
+	}
+	return aws.StringValue(db.DBInstanceArn), aws.StringValue(db.DbiResourceId)
+}
+
+// endpoint returns the endpoint address and port of db, if known.
+func endpoint(db *rds.DBInstance) (string, int64) {
+	if db == nil || db.Endpoint == nil {
+		return "", 0
+	}
+	return aws.StringValue(db.Endpoint.Address), aws.Int64Value(db.Endpoint.Port)
+}
+
+// summaryLine formats the outcome of a wait as key=value pairs, e.g.
+//
+//	result=success id=db1 status=available elapsed=4m12s polls=9 gap_min=25s gap_max=30s gap_avg=27s
+//
+// The keys and their order are fixed; arn and resource_id are present only
+// if withARN is set, and error only on failure.
+func summaryLine(ev event, withARN bool) string {
+	gaps := ev.PollGaps
+	if gaps == nil {
+		gaps = &pollGaps{}
+	}
+	pairs := []string{
+		"result=" + ev.Result,
+		"id=" + logValue(ev.Instance),
+		"status=" + logValue(ev.Status),
+		"elapsed=" + ev.Elapsed,
+		"polls=" + strconv.Itoa(ev.Polls),
+		"gap_min=" + logValue(gaps.Min),
+		"gap_max=" + logValue(gaps.Max),
+		"gap_avg=" + logValue(gaps.Avg),
+	}
+	if withARN {
+		pairs = append(pairs, "arn="+logValue(ev.ARN), "resource_id="+logValue(ev.Resource))
+	}
+	if ev.Error != "" {
+		pairs = append(pairs, "error="+logValue(ev.Error))
+	}
+	return strings.Join(pairs, " ")
+}
+
+// logValue quotes v if it would otherwise be ambiguous in a key=value line.
+func logValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+// An emitter writes events. A nil emitter discards them.
+type emitter struct {
+	mu    sync.Mutex
+	enc   *json.Encoder
+	runID string
+}
+
+// events is the destination for JSON events; it is nil unless --json is set.
+var events *emitter
+
+// newEmitter returns an emitter that writes events to w, each tagged with
+// runID.
+func newEmitter(w io.Writer, runID string) *emitter {
+	return &emitter{enc: json.NewEncoder(w), runID: runID}
+}
+
+func (e *emitter) emit(ev event) {
+	if e == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	ev.Run = e.runID
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enc.Encode(ev)
+}
+
+// newRunID returns a short random identifier for the run.
+func newRunID() string {
+	b := make([]byte, 4)
+	if _, err := cryptorand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// newLogger returns a logger that writes to stderr like the standard logger,
+// with prefix appended to the standard logger's prefix.
+func newLogger(prefix string) *log.Logger {
+	return log.New(os.Stderr, log.Prefix()+prefix, log.Flags())
+}
+
+// A logGate discards everything written to it until it is opened.
+type logGate struct {
+	w    io.Writer
+	open bool
+}
+
+func (g *logGate) Write(p []byte) (int, error) {
+	if !g.open {
+		return len(p), nil
+	}
+	return g.w.Write(p)
+}
+
+// ANSI colours used to highlight status transitions.
+const (
+	colorRed    = "31"
+	colorGreen  = "32"
+	colorYellow = "33"
+)
+
+// colorStatus wraps status in the colour matching its classification: green
+// for a target status, red for one that fails the wait or is terminal (even
+// if the wait goes on through it) and yellow otherwise.
+func colorStatus(c statusClassifier, status string) string {
+	color := colorYellow
+	reached, err := c.classify(status)
+	switch {
+	case err != nil:
+		color = colorRed
+	case reached:
+		color = colorGreen
+	case contains(terminalStatuses, status) && !contains(c.extraTransient, status):
+		color = colorRed
+	}
+	return "\x1b[" + color + "m" + status + "\x1b[0m"
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// checkSeparateStreams fails if stdout and stderr refer to the same file or
+// pipe, in which case JSON events and log lines would be interleaved.
+// Terminals are exempt.
+func checkSeparateStreams() error {
+	out, err := os.Stdout.Stat()
+	if err != nil {
+		return err
+	}
+	errOut, err := os.Stderr.Stat()
+	if err != nil {
+		return err
+	}
+	if os.SameFile(out, errOut) && out.Mode()&os.ModeCharDevice == 0 {
+		return errors.New("stdout and stderr refer to the same file; redirect them separately when using --json")
+	}
+	return nil
+}
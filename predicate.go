@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os/exec"
+
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// runPredicate runs program with args and the JSON description of db on its
+// standard input, and reports whether it exited successfully. Anything the
+// program writes to standard error is logged. The program is killed if ctx is
+// cancelled.
+func runPredicate(ctx context.Context, logger *log.Logger, program string, args []string, db *rds.DBInstance) (bool, error) {
+	input, err := json.Marshal(db)
+	if err != nil {
+		return false, err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, program, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+
+	s := bufio.NewScanner(&stderr)
+	for s.Scan() {
+		logger.Printf("predicate: %s", s.Text())
+	}
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		logger.Printf("waiting: predicate exited with status %d", exitErr.ExitCode())
+		return false, nil
+	}
+	return err == nil, err
+}
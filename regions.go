@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+var (
+	clientsMu sync.Mutex
+	clients   = map[string]*rds.RDS{}
+)
+
+// rdsClient returns a client for the given region, sharing one client per
+// region. An empty region means the default client.
+func rdsClient(region string) *rds.RDS {
+	if region == "" {
+		return svc
+	}
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	client, ok := clients[region]
+	if !ok {
+		client = rds.New(sess, sdkConfig.Copy().WithRegion(region))
+		addRetryHandlers(&client.Handlers, client.Retryer)
+		clients[region] = client
+	}
+	return client
+}
+
+// parseInstanceEntry splits a REGION/ID entry. If the region is optional, a
+// bare ID is accepted and refers to the default region.
+func parseInstanceEntry(entry string, regionOptional bool) (region, id string, err error) {
+	i := strings.Index(entry, "/")
+	switch {
+	case i < 0 && regionOptional && entry != "":
+		return "", entry, nil
+	case i <= 0 || i == len(entry)-1:
+		return "", "", errors.New("expected REGION/ID")
+	}
+	return entry[:i], entry[i+1:], nil
+}
+
+// readInstancesFile reads a list of instances, one ID or REGION/ID per line.
+// Anything from a # to the end of the line is a comment. Blank lines are
+// ignored.
+func readInstancesFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: no instances listed", path)
+	}
+	return entries, nil
+}
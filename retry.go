@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// retryable reports whether err should be retried. Server-side (5xx) errors
+// from the AWS SDK are always retried; other AWS SDK errors are retried only if
+// ignoreErrors is set. All remaining errors are fatal.
+func retryable(err error, ignoreErrors bool) bool {
+	awsErr, ok := err.(awserr.Error)
+	if !ok || awsErr.Code() == "RequestCanceled" {
+		return false
+	}
+	if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() >= 500 {
+		return true
+	}
+	return ignoreErrors
+}
+
+// isAccessDenied reports whether err is an AWS SDK error caused by missing
+// IAM permissions.
+func isAccessDenied(err error) bool {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return false
+	}
+	switch awsErr.Code() {
+	case "AccessDenied", "AccessDeniedException":
+		return true
+	}
+	return false
+}
+
+const (
+	// serverErrorAttempts bounds the consecutive attempts made when only
+	// server-side errors are retried, i.e. without ignoreErrors or
+	// maxAttempts.
+	serverErrorAttempts = 5
+	// maxRetryDelay caps the backoff between consecutive failed attempts.
+	maxRetryDelay = 5 * time.Minute
+)
+
+type retryPolicy struct {
+	ignoreErrors bool
+	maxAttempts  int           // 0 means no limit
+	interval     time.Duration // between attempts; 0 means defaultPollInterval
+
+	// breakAfter is the number of consecutive failures with the same AWS
+	// error code, with no progress in between, after which retry gives up
+	// regardless of ignoreErrors. 0 means no limit.
+	breakAfter int
+	// progress, if set, returns a count that increases whenever fn makes
+	// headway (e.g. a successful describe). An increase resets the
+	// breaker.
+	progress func() int
+}
+
+// withProgress returns a copy of p that consults progress to reset its
+// circuit breaker.
+func (p retryPolicy) withProgress(progress func() int) retryPolicy {
+	p.progress = progress
+	return p
+}
+
+func (p retryPolicy) progressCount() int {
+	if p.progress == nil {
+		return 0
+	}
+	return p.progress()
+}
+
+// backoff returns the delay before the next attempt after failures
+// consecutive failed ones: the interval, doubled for each failure after the
+// first, up to maxRetryDelay.
+func (p retryPolicy) backoff(failures int) time.Duration {
+	d := p.interval
+	if d <= 0 {
+		d = defaultPollInterval
+	}
+	for i := 1; i < failures && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	if d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d
+}
+
+// retry calls fn until it succeeds or fails with an error that is not
+// retryable, backing off between consecutive failures. If fn fails after
+// having been retried, the returned error summarises the errors seen along
+// the way.
+func (p retryPolicy) retry(ctx context.Context, fn func() error) error {
+	var (
+		h        retryHistory
+		b        breaker
+		failures int // since fn last made progress
+		progress = p.progressCount()
+	)
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		h.record(err)
+		if !retryable(err, p.ignoreErrors) {
+			return h.wrap(err)
+		}
+		if p.maxAttempts > 0 && h.attempts >= p.maxAttempts {
+			return h.wrap(err)
+		}
+		if n := p.progressCount(); n != progress {
+			progress = n
+			failures = 0
+			b.reset()
+		}
+		failures++
+		if !p.ignoreErrors && p.maxAttempts == 0 && failures >= serverErrorAttempts {
+			return h.wrap(err)
+		}
+		if b.record(err); p.breakAfter > 0 && b.count >= p.breakAfter {
+			return fmt.Errorf("giving up after %d consecutive %s errors with no progress in between (see --max-identical-errors): %w", b.count, b.code, h.wrap(err))
+		}
+		log.Printf("retrying: %v", err)
+
+		select {
+		case <-time.After(delay(p.backoff(failures))):
+		case <-ctx.Done():
+			return fmt.Errorf("%w while retrying: %v", ctx.Err(), h.wrap(err))
+		}
+	}
+}
+
+// breaker counts consecutive failures that share an AWS error code.
+type breaker struct {
+	code  string
+	count int
+}
+
+func (b *breaker) record(err error) {
+	awsErr, ok := err.(awserr.Error)
+	switch {
+	case !ok:
+		b.reset()
+	case awsErr.Code() == b.code:
+		b.count++
+	default:
+		b.code, b.count = awsErr.Code(), 1
+	}
+}
+
+func (b *breaker) reset() {
+	b.code, b.count = "", 0
+}
+
+// retryHistory tallies the failed attempts made by retry.
+type retryHistory struct {
+	attempts int
+	codes    map[string]int
+}
+
+func (h *retryHistory) record(err error) {
+	h.attempts++
+	if awsErr, ok := err.(awserr.Error); ok {
+		if h.codes == nil {
+			h.codes = make(map[string]int)
+		}
+		h.codes[awsErr.Code()]++
+	}
+}
+
+// wrap annotates the final error with the retry history. Errors that fail
+// on the first attempt, or that are not from the AWS SDK, are returned as-is.
+func (h *retryHistory) wrap(err error) error {
+	if _, ok := err.(awserr.Error); !ok || h.attempts < 2 {
+		return err
+	}
+	codes := make([]string, 0, len(h.codes))
+	for code := range h.codes {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if h.codes[codes[i]] != h.codes[codes[j]] {
+			return h.codes[codes[i]] > h.codes[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+	seen := make([]string, len(codes))
+	for i, code := range codes {
+		seen[i] = fmt.Sprintf("%s×%d", code, h.codes[code])
+	}
+	return fmt.Errorf("gave up after %d attempts; last error: %w; saw %s", h.attempts, err, strings.Join(seen, ", "))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestRetryable(t *testing.T) {
+	failure := func(code string, status int) error {
+		return awserr.NewRequestFailure(awserr.New(code, "test", nil), status, "request-id")
+	}
+	tests := []struct {
+		name         string
+		err          error
+		ignoreErrors bool
+		want         bool
+	}{
+		{"500", failure("InternalFailure", 500), false, true},
+		{"500 ignoring errors", failure("InternalFailure", 500), true, true},
+		{"503", failure("ServiceUnavailable", 503), false, true},
+		{"503 ignoring errors", failure("ServiceUnavailable", 503), true, true},
+		{"400", failure("InvalidParameterValue", 400), false, false},
+		{"400 ignoring errors", failure("InvalidParameterValue", 400), true, true},
+		{"403", failure("AccessDenied", 403), false, false},
+		{"403 ignoring errors", failure("AccessDenied", 403), true, true},
+		{"throttling", failure("Throttling", 400), false, false},
+		{"throttling ignoring errors", failure("Throttling", 400), true, true},
+		{"canceled", awserr.New("RequestCanceled", "test", nil), true, false},
+		{"non-AWS", errors.New("test"), false, false},
+		{"non-AWS ignoring errors", errors.New("test"), true, false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err, tt.ignoreErrors); got != tt.want {
+			t.Errorf("%s: retryable() = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryAttempts(t *testing.T) {
+	serverErr := awserr.NewRequestFailure(awserr.New("InternalFailure", "test", nil), 500, "request-id")
+	clientErr := awserr.NewRequestFailure(awserr.New("InvalidParameterValue", "test", nil), 400, "request-id")
+	tests := []struct {
+		name   string
+		policy retryPolicy
+		err    error
+		want   int
+	}{
+		{"5xx", retryPolicy{}, serverErr, serverErrorAttempts},
+		{"5xx with max attempts", retryPolicy{maxAttempts: 3}, serverErr, 3},
+		{"5xx ignoring errors", retryPolicy{ignoreErrors: true, breakAfter: 7}, serverErr, 7},
+		{"4xx", retryPolicy{}, clientErr, 1},
+		{"4xx ignoring errors", retryPolicy{ignoreErrors: true, maxAttempts: 2}, clientErr, 2},
+	}
+	for _, tt := range tests {
+		tt.policy.interval = time.Nanosecond
+		calls := 0
+		err := tt.policy.retry(context.Background(), func() error {
+			calls++
+			return tt.err
+		})
+		if err == nil {
+			t.Errorf("%s: retry() succeeded, want an error", tt.name)
+		}
+		if calls != tt.want {
+			t.Errorf("%s: made %d attempts, want %d", tt.name, calls, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := retryPolicy{interval: 10 * time.Second}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{6, 5 * time.Minute},
+		{100, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := p.backoff(tt.failures); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
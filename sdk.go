@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+// defaultSDKRetries is the number of retries the SDK makes by default.
+const defaultSDKRetries = 3
+
+// sdkConfig is applied to every AWS client the tool creates.
+var sdkConfig = aws.NewConfig()
+
+// configureSDK sets how the AWS SDK retries individual requests, beneath
+// the tool's own retry loop, and recreates the default clients to match.
+// A negative maxRetries keeps the SDK default.
+func configureSDK(maxRetries int, mode string) {
+	if maxRetries < 0 {
+		maxRetries = defaultSDKRetries
+	}
+	retryer := request.Retryer(client.DefaultRetryer{NumMaxRetries: maxRetries})
+	if mode == "adaptive" {
+		retryer = &adaptiveRetryer{DefaultRetryer: client.DefaultRetryer{NumMaxRetries: maxRetries}, scale: 1}
+	}
+	sdkConfig = request.WithRetryer(aws.NewConfig(), retryer)
+
+	svc = rds.New(sess, sdkConfig)
+	cw = cloudwatch.New(sess, sdkConfig)
+	addRetryHandlers(&svc.Handlers, svc.Retryer)
+	addRetryHandlers(&cw.Handlers, cw.Retryer)
+}
+
+// addRetryHandlers logs whether a failed request had been retried by the
+// SDK, and lets an adaptive retryer observe successes.
+func addRetryHandlers(handlers *request.Handlers, retryer request.Retryer) {
+	handlers.Complete.PushBack(func(r *request.Request) {
+		if a, ok := retryer.(*adaptiveRetryer); ok && r.Error == nil {
+			a.succeeded()
+		}
+		if r.Error == nil || retryer.MaxRetries() == 0 || isCanceled(r.Error) {
+			return
+		}
+		switch {
+		case r.RetryCount >= retryer.MaxRetries():
+			log.Printf("%s: gave up after %d SDK retries", r.Operation.Name, r.RetryCount)
+		case r.RetryCount == 0:
+			log.Printf("%s: failed on the first attempt; not retryable by the SDK", r.Operation.Name)
+		}
+	})
+}
+
+func isCanceled(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == request.CanceledErrorCode
+}
+
+// An adaptiveRetryer is the SDK's default retryer, except that each
+// throttled request doubles the delay before subsequent retries, up to
+// maxScale times the default, and each successful request halves it again.
+type adaptiveRetryer struct {
+	client.DefaultRetryer
+
+	mu    sync.Mutex
+	scale float64
+}
+
+const maxScale = 32
+
+func (a *adaptiveRetryer) RetryRules(r *request.Request) time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if r.IsErrorThrottle() && a.scale < maxScale {
+		a.scale *= 2
+	}
+	return time.Duration(float64(a.DefaultRetryer.RetryRules(r)) * a.scale)
+}
+
+func (a *adaptiveRetryer) succeeded() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.scale > 1 {
+		a.scale /= 2
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminationSignals are the signals that cancel the wait.
+var terminationSignals = []os.Signal{unix.SIGINT, unix.SIGTERM}
@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "os"
+
+// terminationSignals are the signals that cancel the wait. Windows delivers
+// only os.Interrupt (Ctrl+C).
+var terminationSignals = []os.Signal{os.Interrupt}
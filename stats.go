@@ -0,0 +1,48 @@
+package main
+
+import "time"
+
+// pollStats records when a waiter polled, as a count and the spread of the
+// gaps between consecutive polls.
+type pollStats struct {
+	count    int
+	last     time.Time
+	gaps     int
+	min, max time.Duration
+	total    time.Duration
+}
+
+func (s *pollStats) record(t time.Time) {
+	if s.count > 0 {
+		s.addGaps(1, t.Sub(s.last), t.Sub(s.last), t.Sub(s.last))
+	}
+	s.count++
+	s.last = t
+}
+
+func (s *pollStats) addGaps(n int, min, max, total time.Duration) {
+	if n == 0 {
+		return
+	}
+	if s.gaps == 0 || min < s.min {
+		s.min = min
+	}
+	if max > s.max {
+		s.max = max
+	}
+	s.gaps += n
+	s.total += total
+}
+
+// merge folds the polls recorded by o into s.
+func (s *pollStats) merge(o pollStats) {
+	s.count += o.count
+	s.addGaps(o.gaps, o.min, o.max, o.total)
+}
+
+func (s *pollStats) avg() time.Duration {
+	if s.gaps == 0 {
+		return 0
+	}
+	return s.total / time.Duration(s.gaps)
+}
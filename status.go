@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Instance statuses known to the tool, as documented in the RDS user guide.
+var (
+	// availableStatuses are those in which the instance is ready for use.
+	availableStatuses = []string{
+		"available",
+	}
+
+	// transientStatuses are those the tool waits through. The instance
+	// leaves most of them of its own accord; it leaves stopped only once
+	// someone starts it.
+	transientStatuses = []string{
+		"backing-up",
+		"configuring-enhanced-monitoring",
+		"configuring-iam-database-auth",
+		"configuring-log-exports",
+		"converting-to-vpc",
+		"creating",
+		"delete-precheck",
+		"deleting",
+		"maintenance",
+		"modifying",
+		"moving-to-vpc",
+		"rebooting",
+		"renaming",
+		"resetting-master-credentials",
+		"starting",
+		"stopped",
+		"stopping",
+		"storage-config-upgrade",
+		"storage-optimization",
+		"upgrading",
+	}
+
+	// terminalStatuses are those the instance will not leave without
+	// operator intervention. By default the tool waits through them too;
+	// with --fail-on-terminal-status it fails as soon as it observes one.
+	terminalStatuses = []string{
+		"failed",
+		"inaccessible-encryption-credentials",
+		"incompatible-network",
+		"incompatible-option-group",
+		"incompatible-parameters",
+		"incompatible-restore",
+		"insufficient-capacity",
+		"restore-error",
+		"storage-full",
+	}
+)
+
+var (
+	errTerminalStatus = errors.New("terminal status")
+	errRejectedStatus = errors.New("rejected status")
+)
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTerminal fails if failing on terminal statuses was requested, status
+// is terminal and it has not been registered as transient by the user.
+// Unknown statuses are waited through.
+func (c statusClassifier) checkTerminal(status string) error {
+	if c.failTerminal && contains(terminalStatuses, status) && !contains(c.extraTransient, status) {
+		return fmt.Errorf("%w: instance entered %s", errTerminalStatus, status)
+	}
+	return nil
+}
+
+// A statusClassifier decides what each observed status means for the wait.
+// In order of precedence, a status is rejected if it is in the fail set,
+// reached if it is in the target set, and otherwise classified by
+// checkTerminal.
+type statusClassifier struct {
+	targets        []string // defaults to availableStatuses
+	rejects        []string
+	failTerminal   bool
+	extraTransient []string
+
+	// leave, if set, is a status the instance must be seen to leave before
+	// any target counts as reached. If no targets were given, leaving it
+	// is enough.
+	leave     string
+	leaveOnly bool
+}
+
+// newStatusClassifier returns a classifier for the given status sets. A status
+// may not be both a target and rejected.
+func newStatusClassifier(targets, rejects []string, failTerminal bool, extraTransient []string, leave string) (statusClassifier, error) {
+	for _, status := range targets {
+		if contains(rejects, status) {
+			return statusClassifier{}, fmt.Errorf("%s is both a target and a fail status", status)
+		}
+	}
+	c := statusClassifier{
+		targets:        targets,
+		rejects:        rejects,
+		failTerminal:   failTerminal,
+		extraTransient: extraTransient,
+		leave:          leave,
+		leaveOnly:      leave != "" && len(targets) == 0,
+	}
+	if len(targets) == 0 {
+		c.targets = availableStatuses
+	}
+	return c, nil
+}
+
+// classify reports whether status is one the wait is aiming for. It fails if
+// the wait should stop because of status.
+func (c statusClassifier) classify(status string) (bool, error) {
+	switch {
+	case contains(c.rejects, status):
+		return false, fmt.Errorf("%w: instance entered %s", errRejectedStatus, status)
+	case contains(c.targets, status):
+		return true, nil
+	}
+	return false, c.checkTerminal(status)
+}
+
+// printStatuses writes the known statuses to w, grouped by classification.
+func printStatuses(w io.Writer) {
+	groups := []struct {
+		name     string
+		statuses []string
+	}{
+		{"available", availableStatuses},
+		{"transient (waited through)", transientStatuses},
+		{"terminal (fail immediately with --fail-on-terminal-status)", terminalStatuses},
+	}
+	for i, g := range groups {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s:\n", g.name)
+		for _, status := range g.statuses {
+			fmt.Fprintf(w, "  %s\n", status)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name           string
+		targets        []string
+		rejects        []string
+		failTerminal   bool
+		extraTransient []string
+		status         string
+		wantReached    bool
+		wantErr        error
+	}{
+		{name: "default target", status: "available", wantReached: true},
+		{name: "transient", status: "creating"},
+		{name: "unknown", status: "some-new-status", failTerminal: true},
+		{name: "target", targets: []string{"stopped"}, status: "stopped", wantReached: true},
+		{name: "default target replaced", targets: []string{"stopped"}, status: "available"},
+		{name: "fail set", rejects: []string{"stopped"}, status: "stopped", wantErr: errRejectedStatus},
+		{name: "fail set before terminal", rejects: []string{"storage-full"}, failTerminal: true, status: "storage-full", wantErr: errRejectedStatus},
+		{name: "target before terminal", targets: []string{"failed"}, failTerminal: true, status: "failed", wantReached: true},
+		{name: "terminal waited through", status: "storage-full"},
+		{name: "terminal", failTerminal: true, status: "storage-full", wantErr: errTerminalStatus},
+		{name: "extra transient", failTerminal: true, extraTransient: []string{"storage-full"}, status: "storage-full"},
+		{name: "extra transient only affects its status", failTerminal: true, extraTransient: []string{"storage-full"}, status: "failed", wantErr: errTerminalStatus},
+	}
+	for _, tt := range tests {
+		c, err := newStatusClassifier(tt.targets, tt.rejects, tt.failTerminal, tt.extraTransient, "")
+		if err != nil {
+			t.Errorf("%s: newStatusClassifier: %v", tt.name, err)
+			continue
+		}
+		reached, err := c.classify(tt.status)
+		if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+			t.Errorf("%s: classify(%q) error = %v, want %v", tt.name, tt.status, err, tt.wantErr)
+		}
+		if reached != tt.wantReached {
+			t.Errorf("%s: classify(%q) reached = %t, want %t", tt.name, tt.status, reached, tt.wantReached)
+		}
+	}
+}
+
+func TestNewStatusClassifierConflict(t *testing.T) {
+	_, err := newStatusClassifier([]string{"available", "stopped"}, []string{"stopped"}, false, nil, "")
+	if err == nil {
+		t.Fatal("newStatusClassifier accepted a status that is both a target and a fail status")
+	}
+}
+
+func TestPollLeave(t *testing.T) {
+	tests := []struct {
+		name     string
+		targets  []string
+		leave    string
+		statuses []string
+		want     []bool // whether each poll completes the wait
+	}{
+		{
+			name:     "leave only",
+			leave:    "modifying",
+			statuses: []string{"modifying", "modifying", "rebooting"},
+			want:     []bool{false, false, true},
+		},
+		{
+			name:     "leave a target",
+			leave:    "available",
+			statuses: []string{"available", "modifying"},
+			want:     []bool{false, true},
+		},
+		{
+			name:     "leave then reach a target",
+			targets:  []string{"available"},
+			leave:    "modifying",
+			statuses: []string{"modifying", "rebooting", "available"},
+			want:     []bool{false, false, true},
+		},
+		{
+			name:     "already left",
+			targets:  []string{"available"},
+			leave:    "modifying",
+			statuses: []string{"available"},
+			want:     []bool{true},
+		},
+	}
+	for _, tt := range tests {
+		statuses, err := newStatusClassifier(tt.targets, nil, false, nil, tt.leave)
+		if err != nil {
+			t.Errorf("%s: newStatusClassifier: %v", tt.name, err)
+			continue
+		}
+		w := &waiter{instanceID: "db", logger: log.New(io.Discard, "", 0), statuses: statuses}
+		for i, status := range tt.statuses {
+			done, err := w.poll(&rds.DBInstance{DBInstanceStatus: aws.String(status)})
+			if err != nil {
+				t.Errorf("%s: poll %d (%s): %v", tt.name, i, status, err)
+				break
+			}
+			if done != tt.want[i] {
+				t.Errorf("%s: poll %d (%s) done = %t, want %t", tt.name, i, status, done, tt.want[i])
+			}
+		}
+	}
+}
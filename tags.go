@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
+)
+
+// instancesByTag returns the identifiers of all instances that carry every
+// one of the given tags. If bestEffort is set, instances whose tags cannot be
+// read for lack of permission are skipped rather than failing the search.
+func instancesByTag(ctx context.Context, client rdsiface.RDSAPI, tags map[string]string, bestEffort bool) ([]string, error) {
+	instances, err := findInstances(ctx, client, func(db *rds.DBInstance) (bool, error) {
+		ok, err := hasTags(ctx, client, db, tags)
+		if bestEffort && isAccessDenied(err) {
+			log.Printf("warning: skipping %s, whose tags cannot be read: %v", aws.StringValue(db.DBInstanceIdentifier), err)
+			return false, nil
+		}
+		return ok, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("no instances match tags: %v", tags)
+	}
+	return instances, nil
+}
+
+// instancesByIdentifier returns the identifiers of all instances for which
+// match returns true.
+func instancesByIdentifier(ctx context.Context, client rdsiface.RDSAPI, match func(id string) bool) ([]string, error) {
+	return findInstances(ctx, client, func(db *rds.DBInstance) (bool, error) {
+		return match(aws.StringValue(db.DBInstanceIdentifier)), nil
+	})
+}
+
+// findInstances returns the identifiers of all instances for which match
+// returns true. Instances are listed page by page, so the search covers the
+// whole account (region) regardless of its size.
+func findInstances(ctx context.Context, client rdsiface.RDSAPI, match func(db *rds.DBInstance) (bool, error)) ([]string, error) {
+	var (
+		instances []string
+		matchErr  error
+	)
+	err := client.DescribeDBInstancesPagesWithContext(ctx, &rds.DescribeDBInstancesInput{}, func(page *rds.DescribeDBInstancesOutput, lastPage bool) bool {
+		for _, db := range page.DBInstances {
+			var ok bool
+			ok, matchErr = match(db)
+			if matchErr != nil {
+				return false
+			}
+			if ok {
+				instances = append(instances, *db.DBInstanceIdentifier)
+			}
+		}
+		return ctx.Err() == nil
+	})
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err == nil {
+		err = matchErr
+	}
+	return instances, err
+}
+
+func hasTags(ctx context.Context, client rdsiface.RDSAPI, db *rds.DBInstance, want map[string]string) (bool, error) {
+	req := &rds.ListTagsForResourceInput{
+		ResourceName: db.DBInstanceArn,
+	}
+	res, err := client.ListTagsForResourceWithContext(ctx, req)
+	if err != nil {
+		return false, err
+	}
+
+	have := make(map[string]string, len(res.TagList))
+	for _, tag := range res.TagList {
+		have[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	for k, v := range want {
+		if value, ok := have[k]; !ok || value != v {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
+)
+
+// pagedRDS serves DescribeDBInstances from a fixed set of pages and tags
+// from a map keyed by instance ARN.
+type pagedRDS struct {
+	rdsiface.RDSAPI
+	pages [][]string
+	tags  map[string]map[string]string
+
+	// afterPage, if set, is called once each page has been delivered.
+	afterPage func(i int)
+	served    int
+}
+
+func (f *pagedRDS) DescribeDBInstancesPagesWithContext(ctx aws.Context, in *rds.DescribeDBInstancesInput, fn func(*rds.DescribeDBInstancesOutput, bool) bool, opts ...request.Option) error {
+	for i, ids := range f.pages {
+		// Like the SDK, a done context fails the next page request.
+		if err := ctx.Err(); err != nil {
+			return awserr.New(request.CanceledErrorCode, "request context canceled", err)
+		}
+		page := &rds.DescribeDBInstancesOutput{}
+		for _, id := range ids {
+			page.DBInstances = append(page.DBInstances, &rds.DBInstance{
+				DBInstanceIdentifier: aws.String(id),
+				DBInstanceArn:        aws.String("arn:" + id),
+			})
+		}
+		f.served++
+		more := fn(page, i == len(f.pages)-1)
+		if f.afterPage != nil {
+			f.afterPage(i)
+		}
+		if !more {
+			break
+		}
+	}
+	return nil
+}
+
+func (f *pagedRDS) ListTagsForResourceWithContext(ctx aws.Context, in *rds.ListTagsForResourceInput, opts ...request.Option) (*rds.ListTagsForResourceOutput, error) {
+	out := &rds.ListTagsForResourceOutput{}
+	for k, v := range f.tags[*in.ResourceName] {
+		out.TagList = append(out.TagList, &rds.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	return out, nil
+}
+
+func TestInstancesByTag(t *testing.T) {
+	want := map[string]string{"env": "ci"}
+	tests := []struct {
+		name  string
+		pages [][]string
+		tags  map[string]map[string]string
+		want  []string
+	}{
+		{
+			name:  "match on second page",
+			pages: [][]string{{"db1", "db2"}, {"db3"}},
+			tags:  map[string]map[string]string{"arn:db3": want},
+			want:  []string{"db3"},
+		},
+		{
+			name:  "empty page",
+			pages: [][]string{{"db1"}, {}, {"db2"}},
+			tags:  map[string]map[string]string{"arn:db1": want, "arn:db2": want},
+			want:  []string{"db1", "db2"},
+		},
+	}
+	for _, tt := range tests {
+		client := &pagedRDS{pages: tt.pages, tags: tt.tags}
+		got, err := instancesByTag(context.Background(), client, want, false)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInstancesByTagCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	want := map[string]string{"env": "ci"}
+	client := &pagedRDS{
+		pages: [][]string{{"db1"}, {"db2"}, {"db3"}},
+		tags:  map[string]map[string]string{"arn:db1": want, "arn:db2": want, "arn:db3": want},
+	}
+	// The first page is served in full; the cancellation must stop the
+	// search before the next one is requested.
+	client.afterPage = func(i int) {
+		if i == 0 {
+			cancel()
+		}
+	}
+	_, err := instancesByTag(ctx, client, want, false)
+	if err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if client.served != 1 {
+		t.Errorf("served %d pages, want 1", client.served)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parsePositiveDuration parses s as a duration and rejects any that is not
+// greater than zero.
+func parsePositiveDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive, got '%s'", s)
+	}
+	return d, nil
+}
+
+// durationMap is a repeatable kingpin flag value of the form KEY=DURATION.
+type durationMap map[string]time.Duration
+
+func (m durationMap) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("expected KEY=DURATION got '%s'", value)
+	}
+	d, err := parsePositiveDuration(parts[1])
+	if err != nil {
+		return err
+	}
+	m[parts[0]] = d
+	return nil
+}
+
+func (m durationMap) String() string {
+	var pairs []string
+	for k, d := range m {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, d))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m durationMap) IsCumulative() bool {
+	return true
+}
+
+// pollIntervals is a repeatable kingpin flag value of the form
+// [STATUS=]DURATION. A bare duration sets the global interval.
+type pollIntervals struct {
+	global   time.Duration
+	byStatus durationMap
+}
+
+func (p *pollIntervals) Set(value string) error {
+	if strings.Contains(value, "=") {
+		return p.byStatus.Set(value)
+	}
+	d, err := parsePositiveDuration(value)
+	if err != nil {
+		return err
+	}
+	p.global = d
+	return nil
+}
+
+func (p *pollIntervals) String() string {
+	if len(p.byStatus) == 0 {
+		return p.global.String()
+	}
+	return p.global.String() + "," + p.byStatus.String()
+}
+
+func (p *pollIntervals) IsCumulative() bool {
+	return true
+}
+
+// interval returns the poll interval to use while the instance is in status.
+func (p *pollIntervals) interval(status string) time.Duration {
+	if d, ok := p.byStatus[status]; ok {
+		return d
+	}
+	return p.global
+}
+
+// optionalInt64 is a kingpin flag value that records whether it was set, so
+// that zero can be told apart from the flag's absence.
+type optionalInt64 struct {
+	set   bool
+	value int64
+}
+
+func (o *optionalInt64) Set(value string) error {
+	v, err := strconv.ParseInt(value, 0, 64)
+	if err != nil {
+		return err
+	}
+	o.set, o.value = true, v
+	return nil
+}
+
+func (o *optionalInt64) String() string {
+	if !o.set {
+		return ""
+	}
+	return strconv.FormatInt(o.value, 10)
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+var errNotFound = errors.New("no such instance")
+
+func describeDBInstance(ctx context.Context, client *rds.RDS, instanceID string) (*rds.DBInstance, error) {
+	if err := injectedFault(); err != nil {
+		return nil, err
+	}
+
+	req := &rds.DescribeDBInstancesInput{
+		DBInstanceIdentifier: aws.String(instanceID),
+		MaxRecords:           aws.Int64(20),
+	}
+	res, err := client.DescribeDBInstancesWithContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res.DBInstances) == 0 {
+		return nil, fmt.Errorf("%w: %s", errNotFound, instanceID)
+	}
+	if len(res.DBInstances) > 1 {
+		return nil, errors.New("DescribeDBInstances query matched multiple instances")
+	}
+	db := res.DBInstances[0]
+	if db.DBInstanceStatus == nil {
+		return nil, fmt.Errorf("no status for instance: %s", instanceID)
+	}
+	return db, nil
+}
+
+// isNotFound reports whether err indicates that the instance does not exist.
+func isNotFound(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code() == rds.ErrCodeDBInstanceNotFoundFault
+	}
+	return errors.Is(err, errNotFound)
+}
+
+var errNoTransition = errors.New("no status transition")
+
+var errPhaseTimeout = errors.New("phase timeout")
+
+var errStatusTimeout = errors.New("status timeout")
+
+var errStalled = errors.New("stalled")
+
+func subnetGroupCondition(db *rds.DBInstance) string {
+	if db.DBSubnetGroup == nil {
+		return "no subnet group reported for instance"
+	}
+	if status := aws.StringValue(db.DBSubnetGroup.SubnetGroupStatus); status != "Complete" {
+		return fmt.Sprintf("subnet group status: %s", status)
+	}
+	return ""
+}
+
+type waiter struct {
+	instanceID        string
+	cluster           bool   // instanceID names a DB cluster, waited for by waitCluster
+	region            string // empty for the default region
+	svc               *rds.RDS
+	logger            *log.Logger
+	conditions        []condition
+	waitDNS           bool
+	statusTimeouts    map[string]time.Duration
+	maxNoChange       time.Duration
+	pollIntervals     *pollIntervals
+	pollTimeout       time.Duration
+	statuses          statusClassifier
+	retryNotFound     bool
+	verifyFailover    bool
+	predicate         string
+	predicateArgs     []string
+	requireTransition bool // fail unless the instance is seen outside a target status
+	waitOutBackup     bool
+	waitPort          bool
+
+	// Time budgets for the status phase, measured from the first poll, and
+	// the endpoint phase, measured from when the instance became ready.
+	statusPhaseTimeout   time.Duration
+	endpointPhaseTimeout time.Duration
+
+	// onStatusChange, if set, is called from within the poll loop each
+	// time the instance transitions from one status to another.
+	onStatusChange func(old, new string)
+	// onDone, if set, is called by waitAll as soon as the waiter completes.
+	onDone func()
+
+	started      time.Time
+	readyAt      time.Time
+	instance     *rds.DBInstance
+	initialAZ    string
+	status       string
+	since        time.Time
+	left         bool // whether the instance has left statuses.leave
+	transitioned bool // whether the instance has been seen outside a target status
+	backupSince  time.Time
+	backupDone   bool
+	describes    int32 // successful describes; accessed atomically
+	polls        pollStats
+
+	// Set by waitAll once the waiter completes.
+	err     error
+	elapsed time.Duration
+}
+
+// label identifies the waiter's instance, qualified by region if it is not
+// in the default region.
+func (w *waiter) label() string {
+	if w.region == "" {
+		return w.instanceID
+	}
+	return w.region + "/" + w.instanceID
+}
+
+// kind names what the waiter waits for, for use in messages.
+func (w *waiter) kind() string {
+	if w.cluster {
+		return "cluster"
+	}
+	return "instance"
+}
+
+// A waiterFactory returns a waiter for the given instance.
+type waiterFactory func(instanceID string, logger *log.Logger) *waiter
+
+// observe records the latest status of the instance.
+func (w *waiter) observe(status string) {
+	if !w.since.IsZero() && status == w.status {
+		return
+	}
+	old := w.status
+	w.status = status
+	w.since = time.Now()
+	if old != "" && w.onStatusChange != nil {
+		w.onStatusChange(old, status)
+	}
+}
+
+// checkStatusTimeout fails if the instance has remained in its current status
+// for longer than allowed: the --status-timeout for that status if one was
+// given, otherwise maxNoChange unless the status is a target. The two limits
+// fail with errStatusTimeout and errStalled respectively.
+func (w *waiter) checkStatusTimeout(reached bool) error {
+	elapsed := time.Since(w.since)
+	if limit, ok := w.statusTimeouts[w.status]; ok {
+		if elapsed > limit {
+			return fmt.Errorf("%w: %s has been %s for %s (limit %s)", errStatusTimeout, w.kind(), w.status, elapsed.Round(time.Second), limit)
+		}
+		return nil
+	}
+	if !reached && w.maxNoChange > 0 && elapsed > w.maxNoChange {
+		return fmt.Errorf("%w: %s has been %s with no change for %s (limit %s)", errStalled, w.kind(), w.status, elapsed.Round(time.Second), w.maxNoChange)
+	}
+	return nil
+}
+
+// wait blocks until the instance reaches a target status and all of the waiter's
+// conditions are satisfied, then performs any follow-up checks. The two
+// phases may each be given a time budget, which is kept across retries.
+func (w *waiter) wait(ctx context.Context) error {
+	if w.started.IsZero() {
+		w.started = time.Now()
+	}
+	var db *rds.DBInstance
+	err := phase(ctx, "status", w.started, w.statusPhaseTimeout, func(ctx context.Context) (err error) {
+		db, err = w.waitReady(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if w.readyAt.IsZero() {
+		w.readyAt = time.Now()
+	}
+	return phase(ctx, "endpoint", w.readyAt, w.endpointPhaseTimeout, func(ctx context.Context) error {
+		for {
+			completed, err := w.withPollTimeout(ctx, func(ctx context.Context) error {
+				return w.finish(ctx, db)
+			})
+			if err != nil || completed {
+				return err
+			}
+
+			select {
+			case <-time.After(delay(w.pollIntervals.interval(w.status))):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+}
+
+// phase runs fn, failing with errPhaseTimeout if it has not completed by
+// limit after start. A zero limit means no limit.
+func phase(ctx context.Context, name string, start time.Time, limit time.Duration, fn func(context.Context) error) error {
+	if limit <= 0 {
+		return fn(ctx)
+	}
+	phaseCtx, cancel := context.WithDeadline(ctx, start.Add(limit))
+	defer cancel()
+	err := fn(phaseCtx)
+	if err != nil && ctx.Err() == nil && phaseCtx.Err() == context.DeadlineExceeded {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("%w: %s phase did not complete within %s", errPhaseTimeout, name, limit)
+		}
+		return fmt.Errorf("%w: %s phase did not complete within %s: %v", errPhaseTimeout, name, limit, err)
+	}
+	return err
+}
+
+// waitReady polls until the instance reaches a target status and all of the
+// waiter's conditions are satisfied, and returns its final description.
+func (w *waiter) waitReady(ctx context.Context) (*rds.DBInstance, error) {
+	for {
+		var (
+			db   *rds.DBInstance
+			done bool
+		)
+		completed, err := w.withPollTimeout(ctx, func(ctx context.Context) (err error) {
+			db, done, err = w.pollOnce(ctx)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if completed && done {
+			return db, nil
+		}
+
+		select {
+		case <-time.After(delay(w.pollIntervals.interval(w.status))):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// withPollTimeout runs fn, abandoning it if it takes longer than the poll
+// timeout. It reports whether fn ran to completion; an overrun is logged
+// rather than returned, so that the caller carries on with the next poll.
+func (w *waiter) withPollTimeout(ctx context.Context, fn func(context.Context) error) (bool, error) {
+	if w.pollTimeout <= 0 {
+		return true, fn(ctx)
+	}
+	pollCtx, cancel := context.WithTimeout(ctx, w.pollTimeout)
+	defer cancel()
+	err := fn(pollCtx)
+	if err != nil && ctx.Err() == nil && pollCtx.Err() == context.DeadlineExceeded {
+		w.logger.Printf("poll timed out after %s: %v", w.pollTimeout, err)
+		return false, nil
+	}
+	return true, err
+}
+
+// pollOnce describes the instance and reports whether it is ready, returning
+// the description if so.
+func (w *waiter) pollOnce(ctx context.Context) (*rds.DBInstance, bool, error) {
+	w.polls.record(time.Now())
+	db, err := describeDBInstance(ctx, w.svc, w.instanceID)
+	switch {
+	case isNotFound(err) && w.retryNotFound && w.instance == nil:
+		// The instance may not be visible yet if it was only just
+		// created.
+		w.logger.Printf("instance not found; waiting for it to appear")
+		return nil, false, nil
+	case err != nil:
+		return nil, false, err
+	}
+	atomic.AddInt32(&w.describes, 1)
+	done, err := w.poll(db)
+	if err != nil || !done {
+		return nil, false, err
+	}
+	if w.predicate != "" {
+		if ok, err := runPredicate(ctx, w.logger, w.predicate, w.predicateArgs, db); err != nil || !ok {
+			return nil, false, err
+		}
+	}
+	return db, true, nil
+}
+
+func (w *waiter) describeCount() int {
+	return int(atomic.LoadInt32(&w.describes))
+}
+
+// finish performs the checks that follow the instance becoming ready.
+func (w *waiter) finish(ctx context.Context, db *rds.DBInstance) error {
+	if w.verifyFailover {
+		az := aws.StringValue(db.AvailabilityZone)
+		if az == w.initialAZ {
+			return fmt.Errorf("failover did not occur: instance remained in %s", az)
+		}
+		w.logger.Printf("instance failed over from %s to %s", w.initialAZ, az)
+	}
+	if w.waitDNS {
+		if err := w.waitForDNS(ctx, db); err != nil {
+			return err
+		}
+	}
+	if w.waitPort {
+		if db.Endpoint == nil || db.Endpoint.Address == nil || db.Endpoint.Port == nil {
+			return fmt.Errorf("no endpoint for instance: %s", w.instanceID)
+		}
+		if err := waitForPort(ctx, w.logger, *db.Endpoint.Address, *db.Endpoint.Port); err != nil {
+			return err
+		}
+	}
+	return healthcheck(ctx, w.logger, db)
+}
+
+// poll records the latest description of the instance and reports whether
+// the wait is complete.
+func (w *waiter) poll(db *rds.DBInstance) (bool, error) {
+	if w.instance == nil {
+		w.initialAZ = aws.StringValue(db.AvailabilityZone)
+	}
+	w.instance = db
+	status := *db.DBInstanceStatus
+	w.observe(status)
+	w.logger.Printf("instance status: %s", status)
+	events.emit(event{Event: "status", Instance: w.label(), Status: status})
+	// Conditions are evaluated on every poll so that their progress is
+	// logged, but only gate completion once a target status is reached.
+	ready := w.ready(db)
+	reached, err := w.statuses.classify(status)
+	if err != nil {
+		return false, err
+	}
+	if leave := w.statuses.leave; leave != "" && !w.left {
+		if status == leave {
+			reached = false
+		} else {
+			w.left = true
+			w.logger.Printf("instance is no longer %s", leave)
+			reached = reached || w.statuses.leaveOnly
+		}
+	}
+	if w.waitOutBackup {
+		reached = w.trackBackup(status) && reached
+	}
+	if !reached {
+		w.transitioned = true
+	} else if w.requireTransition && !w.transitioned {
+		return false, fmt.Errorf("%w: instance was already %s when first polled", errNoTransition, status)
+	}
+	if reached && ready {
+		return true, nil
+	}
+	return false, w.checkStatusTimeout(reached)
+}
+
+// trackBackup logs the start and end of a backup, and reports whether the
+// wait may complete in status. Once a backup has been seen, only available
+// will do.
+func (w *waiter) trackBackup(status string) bool {
+	switch {
+	case status == "backing-up" && w.backupSince.IsZero():
+		w.backupSince = time.Now()
+		w.logger.Printf("backup in progress; waiting for it to finish")
+	case status != "backing-up" && !w.backupSince.IsZero() && !w.backupDone:
+		w.backupDone = true
+		w.logger.Printf("backup finished after at least %s", time.Since(w.backupSince).Round(time.Second))
+	}
+	return w.backupSince.IsZero() || status == "available"
+}
+
+// ready evaluates every condition against db, logging those that are not
+// yet satisfied.
+func (w *waiter) ready(db *rds.DBInstance) bool {
+	ready := true
+	for _, c := range w.conditions {
+		if pending := c(db); pending != "" {
+			w.logger.Printf("waiting: %s", pending)
+			ready = false
+		}
+	}
+	return ready
+}
+
+const dnsRetryInterval = 5 * time.Second
+
+// waitForDNS blocks until the endpoint address of db resolves.
+func (w *waiter) waitForDNS(ctx context.Context, db *rds.DBInstance) error {
+	if db.Endpoint == nil || db.Endpoint.Address == nil {
+		return fmt.Errorf("no endpoint for instance: %s", w.instanceID)
+	}
+	return waitForHost(ctx, w.logger, *db.Endpoint.Address)
+}
+
+func waitForHost(ctx context.Context, logger *log.Logger, host string) error {
+	for {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err == nil {
+			logger.Printf("endpoint %s resolves to %v", host, addrs)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		logger.Printf("endpoint does not resolve: %v", err)
+
+		select {
+		case <-time.After(dnsRetryInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// waitForPort blocks until a TCP connection to host:port succeeds.
+func waitForPort(ctx context.Context, logger *log.Logger, host string, port int64) error {
+	addr := net.JoinHostPort(host, strconv.FormatInt(port, 10))
+	var d net.Dialer
+	for {
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			conn.Close()
+			logger.Printf("endpoint %s accepts connections", addr)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		logger.Printf("endpoint does not accept connections: %v", err)
+
+		select {
+		case <-time.After(dnsRetryInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// waitAll blocks until every one of the waiters completes, recording the
+// outcome of each. The waiters run concurrently and independently, so that
+// one failing does not hide the progress of the others.
+func waitAll(ctx context.Context, waiters []*waiter, policy retryPolicy) error {
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, w := range waiters {
+		wg.Add(1)
+		go func(w *waiter) {
+			defer wg.Done()
+			w.err = policy.withProgress(w.describeCount).retry(ctx, func() error {
+				return w.wait(ctx)
+			})
+			w.elapsed = time.Since(start)
+			if w.onDone != nil {
+				w.onDone()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	var (
+		failed []string
+		first  error
+	)
+	for _, w := range waiters {
+		if w.err != nil {
+			failed = append(failed, w.label())
+			if first == nil {
+				first = w.err
+			}
+		}
+	}
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("%s: %w", failed[0], first)
+	}
+	return fmt.Errorf("%d of %d instances failed (%s); first error: %w", len(failed), len(waiters), strings.Join(failed, ", "), first)
+}
+
+// commonStatus returns the status shared by all of the waiters, or "mixed" if
+// they differ.
+func commonStatus(waiters []*waiter) string {
+	if len(waiters) == 0 {
+		return ""
+	}
+	status := waiters[0].status
+	for _, w := range waiters[1:] {
+		if w.status != status {
+			return "mixed"
+		}
+	}
+	return status
+}